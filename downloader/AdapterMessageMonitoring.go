@@ -1,7 +1,8 @@
 package main
 
 type XIEnvelop struct {
-	Body Body `xml:"http://schemas.xmlsoap.org/soap/envelope/ Body"`
+	Header XIHeader `xml:"http://schemas.xmlsoap.org/soap/envelope/ Header"`
+	Body   Body     `xml:"http://schemas.xmlsoap.org/soap/envelope/ Body"`
 }
 
 type Body struct {
@@ -28,12 +29,31 @@ type XIgetMessageListResponse struct {
 }
 
 type XIAdapterMessage struct {
-	Direction        string         `xml:"urn:com.sap.aii.mdt.server.adapterframework.ws direction"`
-	MessageID        string         `xml:"urn:com.sap.aii.mdt.server.adapterframework.ws messageID"`
-	MessageKey       string         `xml:"urn:com.sap.aii.mdt.server.adapterframework.ws messageKey"`
-	QualityOfService string         `xml:"urn:com.sap.aii.mdt.server.adapterframework.ws qualityOfService"`
-	Version          string         `xml:"urn:com.sap.aii.mdt.server.adapterframework.ws version"`
-	LogLocations     XILogLocations `xml:"urn:com.sap.aii.mdt.server.adapterframework.ws logLocations"`
+	Direction         string         `xml:"urn:com.sap.aii.mdt.server.adapterframework.ws direction"`
+	MessageID         string         `xml:"urn:com.sap.aii.mdt.server.adapterframework.ws messageID"`
+	MessageKey        string         `xml:"urn:com.sap.aii.mdt.server.adapterframework.ws messageKey"`
+	QualityOfService  string         `xml:"urn:com.sap.aii.mdt.server.adapterframework.ws qualityOfService"`
+	Version           string         `xml:"urn:com.sap.aii.mdt.server.adapterframework.ws version"`
+	Status            string         `xml:"urn:com.sap.aii.mdt.server.adapterframework.ws status"`
+	StartTime         string         `xml:"urn:com.sap.aii.mdt.server.adapterframework.ws startTime"`
+	EndTime           string         `xml:"urn:com.sap.aii.mdt.server.adapterframework.ws endTime"`
+	SenderName        string         `xml:"urn:com.sap.aii.mdt.server.adapterframework.ws senderName"`
+	SenderParty       string         `xml:"urn:com.sap.aii.mdt.server.adapterframework.ws senderParty"`
+	ReceiverName      string         `xml:"urn:com.sap.aii.mdt.server.adapterframework.ws receiverName"`
+	ReceiverParty     string         `xml:"urn:com.sap.aii.mdt.server.adapterframework.ws receiverParty"`
+	Interface         XIInterface    `xml:"urn:com.sap.aii.mdt.server.adapterframework.ws interface"`
+	SenderInterface   XIInterface    `xml:"urn:com.sap.aii.mdt.server.adapterframework.ws senderInterface"`
+	ReceiverInterface XIInterface    `xml:"urn:com.sap.aii.mdt.server.adapterframework.ws receiverInterface"`
+	LogLocations      XILogLocations `xml:"urn:com.sap.aii.mdt.server.adapterframework.ws logLocations"`
+
+	// unique name of the entry within export, see assignEntryNames
+	EntryName string `xml:"-"`
+}
+
+type XIInterface struct {
+	// namespace of nested elements differs between SAP PO releases
+	Name      string `xml:"name"`
+	Namespace string `xml:"namespace"`
 }
 
 type XILogLocations struct {
@@ -41,10 +61,12 @@ type XILogLocations struct {
 }
 
 type XIManifest struct {
-	Payload []struct {
-		Href        string `xml:"http://www.w3.org/1999/xlink href,attr"`
-		Name        string `xml:"http://sap.com/xi/XI/Message/30 Name"`
-		Description string `xml:"http://sap.com/xi/XI/Message/30 Description"`
-		Type        string `xml:"http://sap.com/xi/XI/Message/30 Type"`
-	} `xml:"http://sap.com/xi/XI/Message/30 Payload"`
+	Payload []XIManifestPayload `xml:"http://sap.com/xi/XI/Message/30 Payload"`
+}
+
+type XIManifestPayload struct {
+	Href        string `xml:"http://www.w3.org/1999/xlink href,attr" json:"href"`
+	Name        string `xml:"http://sap.com/xi/XI/Message/30 Name" json:"name,omitempty"`
+	Description string `xml:"http://sap.com/xi/XI/Message/30 Description" json:"description,omitempty"`
+	Type        string `xml:"http://sap.com/xi/XI/Message/30 Type" json:"type,omitempty"`
 }
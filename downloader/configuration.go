@@ -6,27 +6,71 @@ import (
 	"io/ioutil"
 	"net/url"
 	"os"
+	"path"
+	"runtime"
 	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type RuntimeConfiguration struct {
-	ConnectionFilepath  string
-	MessageListFile     string
-	MessageListFilename string
-	OutputDirectory     string
-	GroupOutputBy       OutputGroup
-	OpenTargetDirectory bool
-	ZipMode             OutputZipMode
-	NoComment           bool
-	DownloadThreads     int
-	SaveRawContent      bool
-	SaveXIHeader        bool
-	StatisticsOnly      bool
-	SaveStagingVersions []string
-	SaveLoggingVersions []string
+	ConnectionFilepath   string
+	MessageListFile      string
+	MessageListFilename  string
+	OutputDirectory      string
+	OutputPath           string // template of the export folder below OutputDirectory (-outputpath)
+	OutputRoot           string // export folder, set by prepareFileWriter
+	SID                  string
+	GroupOutputBy        OutputGroup
+	OutputLayout         string
+	TimeZone             *time.Location // -timezone of dates in -layout and file times, nil keeps offset of timestamps
+	OpenTargetDirectory  bool
+	ZipMode              OutputZipMode
+	ArchiveToStdout      bool
+	Deduplicate          bool
+	SplitMode            ArchiveSplitMode
+	SplitSize            int64     // bytes, for -split <N>MB
+	EncryptionKey        []byte    // key of AES-encrypted ZIP entries (-encrypt), nil if not set
+	S3                   *S3Target // upload export to S3-compatible storage, nil if not set
+	NoComment            bool
+	DownloadThreads      int
+	UnpackThreads        int
+	SaveRawContent       bool
+	SaveXIHeader         bool
+	SaveHeaderJSON       bool
+	DynamicConfiguration []string
+	KeepTransferEncoding bool
+	InferExtensions      bool
+	ConvertToUTF8        bool
+	EmbeddedRules        []PayloadPath
+	EmbeddedAuto         bool
+	UnzipArchives        bool
+	UnzipDepth           int
+	UnzipMaxSize         int64
+	FormatMode           PayloadFormatMode
+	FormatIndent         string
+	FormatCanonicalXML   bool
+	FormatSortJSONKeys   bool
+	RedactionRules       []RedactionRule
+	MatchPredicates      []ContentPredicate
+	MatchFirstVersion    bool
+	StatisticsOnly       bool
+	SaveStagingVersions  []string
+	SaveLoggingVersions  []string
+}
+
+// listFlag collects values of repeatable command-line option
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
 }
 
 type ConnectionOptions struct {
@@ -38,9 +82,12 @@ type ConnectionOptions struct {
 type OutputZipMode string
 
 const (
-	ZipNone OutputZipMode = "none"
-	ZipFile               = "file"
-	ZipAll                = "all"
+	ZipNone   OutputZipMode = "none"
+	ZipFile                 = "file"
+	ZipAll                  = "all"
+	ZipTar                  = "tar"
+	ZipTgz                  = "tgz"
+	ZipSQLite               = "sqlite"
 )
 
 type OutputGroup string
@@ -70,6 +117,10 @@ const (
 	LogVersionSpecialJSON         = "json"
 	LogVersionSpecialJSONSender   = "jsonsend"
 	LogVersionSpecialJSONReceiver = "jsonrecv"
+
+	LogVersionExcludePrefix = "!"
+	LogVersionCustomPrefix  = "custom:" // custom log location, requested exactly as named
+	logVersionGlobChars     = `*?[\`
 )
 
 const (
@@ -85,7 +136,7 @@ func ParseLaunchOptions() (RuntimeConfiguration, error) {
 	messageIDs := flag.String("ids", "", "Required. Path to a list of message IDs to download, one message per line.")
 	logVersions := flag.String("log", LogVersionSpecialAll,
 		fmt.Sprintf(
-			"Comma-separated list of log versions which must be exported. Supports standard version names (BI, MS, etc) and special values (%s, %s, %s, %s, %s). See details in documentation. ",
+			"Comma-separated list of log versions which must be exported. Supports standard version names (BI, MS, etc), custom names (custom:<name>), glob patterns (*JSON*), exclusions (!VO) and special values (%s, %s, %s, %s, %s). See details in documentation. ",
 			LogVersionSpecialAll,
 			LogVersionSpecialNone,
 			LogVersionSpecialJSON,
@@ -100,15 +151,10 @@ func ParseLaunchOptions() (RuntimeConfiguration, error) {
 			StageVersionSpecialLast,
 			StageVersionSpecialNone))
 
-	flag.BoolVar(&options.SaveXIHeader, "xiheader", false, "If specified, XI header will be saved as payload")
-	flag.BoolVar(&options.SaveRawContent, "raw", false, "If specified, raw contents (multipart message format) be saved as payload")
-	groupBy := flag.String("groupby", "version", "Group payloads by message ID, message version or both")
-	flag.StringVar(&options.OutputDirectory, "output", "./export/", "Destination folder to save exported payloads")
-	flag.BoolVar(&options.OpenTargetDirectory, "opendir", false, "Open destination folder in Explorer when download process ends")
-	zipMode := flag.String("zip", "all", "Mode of compression for exported payloads. Available options are: (n)one, (f)ile, (a)ll")
+	processOutputFlags := registerOutputFlags(flag.CommandLine, options)
 	flag.IntVar(&options.DownloadThreads, "threads", 2, "Number of parallel HTTP download threads")
+	flag.BoolVar(&options.MatchFirstVersion, "matchfirst", false, "If specified, -match is checked on the first version of each message. Other versions are downloaded and saved only if it matched.")
 	flag.BoolVar(&options.StatisticsOnly, "statsonly", false, "If specified, only statistics on available message versions will be displayed. No actual download will happen.")
-	flag.BoolVar(&options.NoComment, "nocomment", false, "If specified, no text comment will be added to ZIP file (applies to -zip all).")
 
 	//////////////
 
@@ -123,17 +169,9 @@ func ParseLaunchOptions() (RuntimeConfiguration, error) {
 		}
 	}
 
-	if zipMode != nil {
-		switch strings.ToLower(*zipMode) {
-		case "n", "none":
-			options.ZipMode = ZipNone
-		case "a", "all":
-			options.ZipMode = ZipAll
-		case "f", "file":
-			options.ZipMode = ZipFile
-		default:
-			return *options, fmt.Errorf("Unsupported ZIP option: [%s]", *zipMode)
-		}
+	err := processOutputFlags()
+	if err != nil {
+		return *options, err
 	}
 
 	if logVersions != nil {
@@ -154,22 +192,16 @@ func ParseLaunchOptions() (RuntimeConfiguration, error) {
 		options.SaveStagingVersions = stageList
 	}
 
-	if groupBy != nil {
-		groupByParsed, err := processGroupingFlag(*groupBy)
-		if err != nil {
-			return *options, err
-		}
-		options.GroupOutputBy = groupByParsed
-	} else {
-		options.GroupOutputBy = OutputGroupNone
-	}
-
 	//////////// checks
 
 	if options.DownloadThreads < 1 {
 		return *options, fmt.Errorf("Number of download threads must be no less than 1. Value [%d] is incorrect", options.DownloadThreads)
 	}
 
+	if options.MatchFirstVersion && len(options.MatchPredicates) == 0 {
+		return *options, fmt.Errorf("Option -matchfirst requires -match")
+	}
+
 	if len(options.SaveLoggingVersions) == 0 && len(options.SaveStagingVersions) == 0 {
 		return *options, fmt.Errorf("No message versions are selected for export")
 	}
@@ -177,6 +209,233 @@ func ParseLaunchOptions() (RuntimeConfiguration, error) {
 	return *options, nil
 }
 
+// ParseUnpackOptions parses command-line of "unpack" command. Returns list of input files.
+func ParseUnpackOptions(args []string) (RuntimeConfiguration, []string, error) {
+	options := new(RuntimeConfiguration)
+
+	fs := flag.NewFlagSet(CommandUnpack, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s %s [options] <file, folder or ZIP archive> ...\n", path.Base(os.Args[0]), CommandUnpack)
+		fs.PrintDefaults()
+	}
+	processOutputFlags := registerOutputFlags(fs, options)
+
+	fs.Parse(args)
+
+	err := processOutputFlags()
+	if err != nil {
+		return *options, nil, err
+	}
+
+	if fs.NArg() == 0 {
+		return *options, nil, fmt.Errorf("No input files are specified")
+	}
+
+	return *options, fs.Args(), nil
+}
+
+func ParseVerifyOptions(args []string) ([]string, []byte, error) {
+	fs := flag.NewFlagSet(CommandVerify, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s %s [options] <export folder, ZIP, TAR, TGZ archive or SQLite database> ...\n", path.Base(os.Args[0]), CommandVerify)
+		fs.PrintDefaults()
+	}
+	encrypt := fs.String("encrypt", "", "Key of encrypted ZIP archives: file:<path> or env:<variable>")
+
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		return nil, nil, fmt.Errorf("No export folders or archives are specified")
+	}
+
+	var key []byte
+	if *encrypt != "" {
+		var err error
+		key, err = readSecret(*encrypt)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return fs.Args(), key, nil
+}
+
+// registerOutputFlags defines options for processing and saving payloads, shared by
+// download and unpack commands. Returned function must be called after parsing.
+func registerOutputFlags(fs *flag.FlagSet, options *RuntimeConfiguration) func() error {
+	fs.BoolVar(&options.SaveXIHeader, "xiheader", false, "If specified, XI header will be saved as payload")
+	fs.BoolVar(&options.SaveHeaderJSON, "headerjson", false, "If specified, parsed XI header (sender, receiver, dynamic configuration, hop list, etc) will be saved as header.json")
+	dynamicConfiguration := fs.String("dynconf", "", "Comma-separated list of dynamic configuration keys (e.g. FileName,SAction) exported for all messages to dynamic_configuration.csv")
+	fs.BoolVar(&options.SaveRawContent, "raw", false, "If specified, raw contents (multipart message format) be saved as payload")
+	fs.BoolVar(&options.KeepTransferEncoding, "keepencoding", false, "If specified, parts sent with Content-Transfer-Encoding (base64, quoted-printable) are saved without decoding")
+	fs.BoolVar(&options.InferExtensions, "ext", false, "If specified, file extensions (.xml, .json, .pdf, etc) are added to payload names based on content type and contents")
+	fs.BoolVar(&options.UnzipArchives, "unzip", false, "If specified, entries of ZIP and GZIP payloads (e.g. created by PayloadZipBean) are extracted as additional payloads")
+	fs.IntVar(&options.UnzipDepth, "unzipdepth", 3, "Maximum nesting level of archives extracted with -unzip")
+	unzipMaxSize := fs.Int("unzipmax", 256, "Maximum size in MB of contents extracted with -unzip from one payload")
+	embedded := new(listFlag)
+	fs.Var(embedded, "embedded", `Path to base64 contents inside XML or JSON payloads to be saved as separate files, e.g. //ContentData or $.attachments[*].content, or "auto" for heuristic detection. Can be repeated.`)
+	fs.BoolVar(&options.ConvertToUTF8, "utf8", false, "If specified, text payloads in other character sets (ISO-8859-1, windows-1251, UTF-16, etc) are converted to UTF-8")
+	formatMode := fs.String("format", "none", "Pretty-print XML and JSON payloads. Available options are: (n)one, (r)eplace original contents, (a)longside original as *.formatted files")
+	indent := fs.String("indent", "2", `Indentation for -format: number of spaces or "tab"`)
+	fs.BoolVar(&options.FormatCanonicalXML, "c14n", false, "If specified, formatted XML is canonicalized (C14N-style: sorted attributes, no XML declaration and comments)")
+	fs.BoolVar(&options.FormatSortJSONKeys, "sortkeys", false, "If specified, keys of formatted JSON objects are sorted")
+	match := new(listFlag)
+	fs.Var(match, "match", "Save only message versions whose payloads match the condition: regex:<expression>, xpath:<path>[=<value>] or jsonpath:<path>[=<value>]. Can be repeated, any of conditions must match.")
+	redact := fs.String("redact", "", "File with redaction rules applied to payloads, RAW and XI header before saving. See details in documentation.")
+	groupBy := fs.String("groupby", "version", "Group payloads by message ID, message version or both")
+	layout := fs.String("layout", "", "Template for folders and filenames inside output folder, e.g. {receiverInterface}/{date:yyyy-MM-dd}/{messageId}/{version}/{payload}. Overrides -groupby. See details in documentation.")
+	timeZone := fs.String("timezone", "", "Time zone of message timestamps in -layout dates and modification times of files, e.g. Europe/Berlin, UTC or Local. By default offset returned by SAP PO is kept")
+	fs.StringVar(&options.OutputDirectory, "output", "./export/", "Destination folder to save exported payloads")
+	outputPath := fs.String("outputpath", OutputPathDefault, "Template of the export folder inside -output. Available tokens: {host}, {sid}, {timestamp} or {timestamp:yyyy-MM-dd}, {idfile}")
+	fs.StringVar(&options.SID, "sid", "", "System ID of SAP PO used for {sid} token of -outputpath. Hostname is used if not specified")
+	fs.BoolVar(&options.OpenTargetDirectory, "opendir", false, "Open destination folder in Explorer when download process ends")
+	zipMode := fs.String("zip", "all", "Mode of compression for exported payloads. Available options are: (n)one, (f)ile, (a)ll, (t)ar, tgz, sqlite")
+	split := fs.String("split", "", "Split -zip all archive: one per message ID (msg), one per folder (folder) or volumes capped at size, e.g. 100MB")
+	encrypt := fs.String("encrypt", "", "Encrypt entries of -zip all archive with AES-256 (WinZip AE-2, opened by 7-Zip and WinZip). Key is read from file:<path> (first line) or env:<variable>")
+	fs.BoolVar(&options.ArchiveToStdout, "stdout", false, "If specified, archive (-zip all, tar or tgz) is written to standard output instead of a file, console messages are written to standard error")
+	s3 := fs.String("s3", "", "S3 connection file (bucket URL, access key, secret key). If specified, export is uploaded to S3-compatible storage (AWS, MinIO) after it is written. See details in documentation.")
+	s3Region := fs.String("s3region", S3DefaultRegion, "Region of S3 storage used for request signing")
+	s3PartSize := fs.Int("s3partsize", 16, "Files larger than this size in MB are uploaded to S3 in parts (multipart upload), minimum is 5")
+	fs.BoolVar(&options.Deduplicate, "dedup", false, "If specified, identical files are saved once: later copies are hard links (-zip none, file, tar, tgz) or only referenced in manifest (-zip all)")
+	fs.IntVar(&options.UnpackThreads, "unpackers", 0, "Number of parallel unpacking threads, 0 means number of CPU cores")
+	fs.BoolVar(&options.NoComment, "nocomment", false, "If specified, no text comment will be added to ZIP file (applies to -zip all).")
+
+	return func() error {
+		switch strings.ToLower(*zipMode) {
+		case "n", "none":
+			options.ZipMode = ZipNone
+		case "a", "all":
+			options.ZipMode = ZipAll
+		case "f", "file":
+			options.ZipMode = ZipFile
+		case "t", "tar":
+			options.ZipMode = ZipTar
+		case "tgz", "tar.gz":
+			options.ZipMode = ZipTgz
+		case "sqlite", "db":
+			options.ZipMode = ZipSQLite
+		default:
+			return fmt.Errorf("Unsupported ZIP option: [%s]", *zipMode)
+		}
+
+		if options.ArchiveToStdout && (options.ZipMode == ZipNone || options.ZipMode == ZipFile || options.ZipMode == ZipSQLite) {
+			return fmt.Errorf("Option -stdout requires -zip all, tar or tgz")
+		}
+
+		outputPathParsed, err := processOutputPathFlag(*outputPath)
+		if err != nil {
+			return err
+		}
+		options.OutputPath = outputPathParsed
+
+		splitMode, splitSize, err := processSplitFlag(*split)
+		if err != nil {
+			return err
+		}
+		options.SplitMode, options.SplitSize = splitMode, splitSize
+		if options.SplitMode != SplitNone && (options.ZipMode != ZipAll || options.ArchiveToStdout) {
+			return fmt.Errorf("Option -split requires -zip all and cannot be used with -stdout")
+		}
+
+		if options.UnpackThreads < 0 {
+			return fmt.Errorf("Number of unpacking threads must not be negative. Value [%d] is incorrect", options.UnpackThreads)
+		}
+		if options.UnpackThreads == 0 {
+			options.UnpackThreads = runtime.NumCPU()
+		}
+
+		options.UnzipMaxSize = int64(*unzipMaxSize) * 1024 * 1024
+		if options.UnzipArchives && (options.UnzipDepth < 1 || options.UnzipMaxSize < 1) {
+			return fmt.Errorf("Limits for -unzip must be positive: depth [%d], size [%d] MB", options.UnzipDepth, *unzipMaxSize)
+		}
+
+		for _, rule := range *embedded {
+			if strings.EqualFold(strings.TrimSpace(rule), EmbeddedAuto) {
+				options.EmbeddedAuto = true
+				continue
+			}
+
+			path, err := parsePayloadPath(rule)
+			if err != nil {
+				return err
+			}
+			options.EmbeddedRules = append(options.EmbeddedRules, path)
+		}
+
+		options.DynamicConfiguration = processDynamicConfigurationFlag(*dynamicConfiguration)
+
+		for _, input := range *match {
+			predicate, err := parseContentPredicate(input)
+			if err != nil {
+				return err
+			}
+			options.MatchPredicates = append(options.MatchPredicates, predicate)
+		}
+
+		if *encrypt != "" {
+			if options.ZipMode != ZipAll {
+				return fmt.Errorf("Option -encrypt requires -zip all")
+			}
+			key, err := readSecret(*encrypt)
+			if err != nil {
+				return err
+			}
+			options.EncryptionKey = key
+		}
+
+		if *s3 != "" {
+			if options.ArchiveToStdout {
+				return fmt.Errorf("Option -s3 cannot be used with -stdout")
+			}
+			target, err := GetS3Config(*s3, *s3Region, int64(*s3PartSize)*1024*1024)
+			if err != nil {
+				return err
+			}
+			options.S3 = &target
+		}
+
+		if *redact != "" {
+			rules, err := loadRedactionRules(*redact)
+			if err != nil {
+				return err
+			}
+			options.RedactionRules = rules
+		}
+
+		formatParsed, err := processFormatFlag(*formatMode)
+		if err != nil {
+			return err
+		}
+		options.FormatMode = formatParsed
+
+		indentParsed, err := processIndentFlag(*indent)
+		if err != nil {
+			return err
+		}
+		options.FormatIndent = indentParsed
+
+		groupByParsed, err := processGroupingFlag(*groupBy)
+		if err != nil {
+			return err
+		}
+		options.GroupOutputBy = groupByParsed
+
+		layoutParsed, err := processLayoutFlag(*layout)
+		if err != nil {
+			return err
+		}
+		options.OutputLayout = layoutParsed
+
+		timeZoneParsed, err := processTimeZoneFlag(*timeZone)
+		if err != nil {
+			return err
+		}
+		options.TimeZone = timeZoneParsed
+
+		return nil
+	}
+}
+
 func processLogVersionsConfig(input string) ([]string, error) {
 	supportedTokens := []string{LogVersionBI, LogVersionVI, LogVersionMS, LogVersionAM, LogVersionVO, LogVersionJSONReceiverRequest, LogVersionJSONSenderRequest, LogVersionJSONSenderResponse, LogVersionJSONReceiverResponse, LogVersionSpecialAll, LogVersionSpecialNone, LogVersionSpecialJSON, LogVersionSpecialJSONSender, LogVersionSpecialJSONReceiver}
 	/////////
@@ -191,30 +450,71 @@ func processLogVersionsConfig(input string) ([]string, error) {
 
 	pieces := strings.Split(input, ",")
 	for i, _ := range pieces {
-		s := strings.TrimSpace(strings.ToLower(pieces[i]))
+		s := strings.TrimSpace(pieces[i])
 
 		if s == "" {
 			// skip empty
 			continue
 		}
 
-		idx := slices.Index(supportedTokensLowercase, s)
-		if idx == -1 {
-			return nil, fmt.Errorf(`unsupported token [%s]`, pieces[i])
+		exclude := strings.HasPrefix(s, LogVersionExcludePrefix)
+		if exclude {
+			s = strings.TrimSpace(strings.TrimPrefix(s, LogVersionExcludePrefix))
+			if s == "" {
+				return nil, fmt.Errorf(`empty exclusion [%s]`, pieces[i])
+			}
 		}
 
-		token := supportedTokens[idx]
-		switch token {
-		case LogVersionSpecialJSON:
-			tempList = append(tempList, LogVersionJSONReceiverRequest, LogVersionJSONSenderRequest, LogVersionJSONSenderResponse, LogVersionJSONReceiverResponse)
+		var tokens []string
+		idx := slices.Index(supportedTokensLowercase, strings.ToLower(s))
+		custom := strings.HasPrefix(strings.ToLower(s), LogVersionCustomPrefix)
+		if custom {
+			s = strings.TrimSpace(s[len(LogVersionCustomPrefix):])
+			if s == "" {
+				return nil, fmt.Errorf(`empty custom log version [%s]`, pieces[i])
+			}
+			tokens = []string{s}
+		} else if idx == -1 {
+			if strings.ContainsAny(s, logVersionGlobChars) {
+				// glob pattern, checked against locations reported by each message later on
+				_, err := path.Match(s, "")
+				if err != nil {
+					return nil, fmt.Errorf(`malformed pattern [%s]`, pieces[i])
+				}
+			} else if strings.ContainsAny(s, " \t") {
+				// most likely missing comma ("VO AM")
+				return nil, fmt.Errorf(`unknown log version [%s], separate versions with commas or use %s<name> for names with spaces`, pieces[i], LogVersionCustomPrefix)
+			} else {
+				// custom log location, or a typo (jsonreq) which must not pass unnoticed
+				fmt.Printf("Warning: log version [%s] is not a standard one, it is saved only for messages with such log location. Use %s%s to hide this warning\n", s, LogVersionCustomPrefix, s)
+			}
+			tokens = []string{s}
+		} else {
+			switch token := supportedTokens[idx]; token {
+			case LogVersionSpecialJSON:
+				tokens = []string{LogVersionJSONReceiverRequest, LogVersionJSONSenderRequest, LogVersionJSONSenderResponse, LogVersionJSONReceiverResponse}
 
-		case LogVersionSpecialJSONSender:
-			tempList = append(tempList, LogVersionJSONSenderRequest, LogVersionJSONSenderResponse)
+			case LogVersionSpecialJSONSender:
+				tokens = []string{LogVersionJSONSenderRequest, LogVersionJSONSenderResponse}
 
-		case LogVersionSpecialJSONReceiver:
-			tempList = append(tempList, LogVersionJSONReceiverRequest, LogVersionJSONReceiverResponse)
+			case LogVersionSpecialJSONReceiver:
+				tokens = []string{LogVersionJSONReceiverRequest, LogVersionJSONReceiverResponse}
 
-		default:
+			case LogVersionSpecialAll, LogVersionSpecialNone:
+				if exclude {
+					return nil, fmt.Errorf(`cannot exclude "%s"`, token)
+				}
+				tokens = []string{token}
+
+			default:
+				tokens = []string{token}
+			}
+		}
+
+		for _, token := range tokens {
+			if exclude {
+				token = LogVersionExcludePrefix + token
+			}
 			tempList = append(tempList, token)
 		}
 
@@ -238,14 +538,61 @@ func processLogVersionsConfig(input string) ([]string, error) {
 		return nil, fmt.Errorf(`cannot use "%s" with any other tokens`, LogVersionSpecialNone)
 	}
 
-	// ALL and anything else
+	// ALL and anything else except exclusions
 	if len(tempList) > 1 && slices.Contains(tempList, LogVersionSpecialAll) {
-		return []string{LogVersionSpecialAll}, nil
+		return slices.DeleteFunc(tempList, func(token string) bool {
+			return token != LogVersionSpecialAll && !strings.HasPrefix(token, LogVersionExcludePrefix)
+		}), nil
 	}
 
 	return tempList, nil
 }
 
+// selectLogVersions filters log locations reported by a message using the list
+// produced by processLogVersionsConfig. Names are compared case-insensitively,
+// glob patterns follow path.Match syntax and entries starting with "!" exclude
+// matching locations. List without any positive entry selects everything.
+func selectLogVersions(selection []string, available []string) []string {
+	includeAll := true
+	for _, pattern := range selection {
+		if pattern != LogVersionSpecialAll && !strings.HasPrefix(pattern, LogVersionExcludePrefix) {
+			includeAll = false
+			break
+		}
+	}
+
+	result := []string{}
+	for _, name := range available {
+		included, excluded := includeAll, false
+
+		for _, pattern := range selection {
+			if strings.HasPrefix(pattern, LogVersionExcludePrefix) {
+				excluded = excluded || matchLogVersion(strings.TrimPrefix(pattern, LogVersionExcludePrefix), name)
+			} else {
+				included = included || matchLogVersion(pattern, name)
+			}
+		}
+
+		if included && !excluded {
+			result = append(result, name)
+		}
+	}
+
+	return result
+}
+
+func matchLogVersion(pattern string, name string) bool {
+	pattern = strings.ToLower(pattern)
+	name = strings.ToLower(name)
+
+	if pattern == name {
+		return true
+	}
+
+	matched, _ := path.Match(pattern, name)
+	return matched
+}
+
 func processStageVersionsConfig(input string) ([]string, error) {
 	supportedTokens := []string{StageVersionSpecialAll, StageVersionSpecialLast, StageVersionSpecialNone}
 	/////////
@@ -341,10 +688,20 @@ func GetConnectionConfig(options RuntimeConfiguration) (ConnectionOptions, error
 		return ConnectionOptions{}, fmt.Errorf("Connection file [%s] is incorrect", options.ConnectionFilepath)
 	}
 
+	// password can be kept out of the file with {file:<path>} or {env:<variable>}. Plain
+	// file: and env: are a part of the password, as in connection files of older versions.
+	password := []byte(strings.TrimSpace(lines[2]))
+	if source, ok := secretReference(string(password)); ok {
+		password, err = readSecret(source)
+		if err != nil {
+			return ConnectionOptions{}, fmt.Errorf("Connection file [%s] is incorrect, password cannot be read: %s", options.ConnectionFilepath, err)
+		}
+	}
+
 	connect := ConnectionOptions{
 		Hostname: strings.TrimSpace(lines[0]),
 		Username: strings.TrimSpace(lines[1]),
-		Password: strings.TrimSpace(lines[2]),
+		Password: string(password),
 	}
 
 	parsedURL := new(url.URL)
@@ -386,3 +743,27 @@ func processGroupingFlag(input string) (OutputGroup, error) {
 		return OutputGroupError, fmt.Errorf(`Group option [%s] is unknown`, input)
 	}
 }
+
+func processDynamicConfigurationFlag(input string) []string {
+	keys := []string{}
+
+	for _, piece := range strings.Split(input, ",") {
+		key := strings.TrimSpace(piece)
+		if key == "" {
+			continue
+		}
+
+		duplicate := false
+		for _, existing := range keys {
+			if strings.EqualFold(existing, key) {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
@@ -20,24 +20,36 @@ func TestConfigurationLogParsing(t *testing.T) {
 		{"05", "MS,AM,MS,AM", []string{LogVersionAM, LogVersionMS}},
 		{"06", "MS, VO AM", []string(nil)},
 		{"07", "json", []string{LogVersionJSONReceiverRequest, LogVersionJSONReceiverResponse, LogVersionJSONSenderRequest, LogVersionJSONSenderResponse}},
-		{"08a", "jsonreq,Am", []string(nil)},
+		{"08a", "jsonreq,Am", []string{LogVersionAM, "jsonreq"}},
 		{"08b", "jsonsend,Am", []string{LogVersionAM, LogVersionJSONSenderRequest, LogVersionJSONSenderResponse}},
-		{"09a", "VI,jsonresp,MA", []string(nil)},
-		{"09b", "VI,jsonrecv,MA", []string(nil)},
-		{"10a", "MS, Sender json Response,jsonreq", []string(nil)},
+		{"09a", "VI,jsonresp,MA", []string{"MA", LogVersionVI, "jsonresp"}},
+		{"09b", "VI,jsonrecv,MA", []string{"MA", LogVersionJSONReceiverRequest, LogVersionJSONReceiverResponse, LogVersionVI}},
+		{"10a", "MS, Sender json Response,jsonreq", []string{LogVersionMS, LogVersionJSONSenderResponse, "jsonreq"}},
 		{"10b", "MS, Sender json Response,jsonsend", []string{LogVersionMS, LogVersionJSONSenderRequest, LogVersionJSONSenderResponse}},
 		{"10c", "MS, Receiver json Request,jsonsend", []string{LogVersionMS, LogVersionJSONReceiverRequest, LogVersionJSONSenderRequest, LogVersionJSONSenderResponse}},
-		{"11", " MS, VO ,AM, OV ", []string(nil)},
-		{"12", " nooone ", []string(nil)},
+		{"11", " MS, VO ,AM, OV ", []string{LogVersionAM, LogVersionMS, "OV", LogVersionVO}},
+		{"12", " nooone ", []string{"nooone"}},
 		{"13", " ", []string(nil)},
 		{"14", "none,MS,AM", []string(nil)},
-		{"15a", "json, jsonreq", []string(nil)},
+		{"15a", "json, jsonreq", []string{LogVersionJSONReceiverRequest, LogVersionJSONReceiverResponse, LogVersionJSONSenderRequest, LogVersionJSONSenderResponse, "jsonreq"}},
 		{"15b", "json, jsonsend", []string{LogVersionJSONReceiverRequest, LogVersionJSONReceiverResponse, LogVersionJSONSenderRequest, LogVersionJSONSenderResponse}},
-		{"16a", ",json, jsonreq", []string(nil)},
+		{"16a", ",json, jsonreq", []string{LogVersionJSONReceiverRequest, LogVersionJSONReceiverResponse, LogVersionJSONSenderRequest, LogVersionJSONSenderResponse, "jsonreq"}},
 		{"16b", ",json, jsonsend", []string{LogVersionJSONReceiverRequest, LogVersionJSONReceiverResponse, LogVersionJSONSenderRequest, LogVersionJSONSenderResponse}},
-		{"17a", "am,json, jsonreq", []string(nil)},
+		{"17a", "am,json, jsonreq", []string{LogVersionAM, LogVersionJSONReceiverRequest, LogVersionJSONReceiverResponse, LogVersionJSONSenderRequest, LogVersionJSONSenderResponse, "jsonreq"}},
 		{"17b", "am,json, jsonsend", []string{LogVersionAM, LogVersionJSONReceiverRequest, LogVersionJSONReceiverResponse, LogVersionJSONSenderRequest, LogVersionJSONSenderResponse}},
 		{"18", "all, json", []string{LogVersionSpecialAll}},
+		{"19", "*JSON*", []string{"*JSON*"}},
+		{"20", "!VO", []string{"!VO"}},
+		{"21", "all, !vo, MS", []string{"!VO", LogVersionSpecialAll}},
+		{"22", "!json, BI", []string{"!Receiver JSON Request", "!Receiver JSON Response", "!Sender JSON Request", "!Sender JSON Response", LogVersionBI}},
+		{"23", "none, !VO", []string(nil)},
+		{"24", "!all", []string(nil)},
+		{"25", "MS, !", []string(nil)},
+		{"26", "MS, [AB", []string(nil)},
+		{"27", "custom:Custom Step, AM", []string{LogVersionAM, "Custom Step"}},
+		{"28", "Custom Step, AM", []string(nil)},
+		{"29", "!Custom:VO_STEP, BI", []string{"!VO_STEP", LogVersionBI}},
+		{"30", "custom: ", []string(nil)},
 	}
 
 	for _, test := range tests {
@@ -47,6 +59,42 @@ func TestConfigurationLogParsing(t *testing.T) {
 	// end
 }
 
+func TestLogVersionSelection(t *testing.T) {
+	available := []string{"BI", "MS", "VO", "Sender JSON Request", "Receiver JSON Response", "CUSTOM_STEP"}
+
+	tests := []struct {
+		Index    string
+		Input    string
+		Expected []string
+	}{
+		{"01", "all", available},
+		{"02", "ms,bi", []string{"BI", "MS"}},
+		{"03", "*JSON*", []string{"Sender JSON Request", "Receiver JSON Response"}},
+		{"04", "!VO", []string{"BI", "MS", "Sender JSON Request", "Receiver JSON Response", "CUSTOM_STEP"}},
+		{"05", "all,!json,!custom*", []string{"BI", "MS", "VO"}},
+		{"06", "*json*,!sender*", []string{"Receiver JSON Response"}},
+		{"07", "AM", []string{}},
+		{"08", "custom:custom_step", []string{"CUSTOM_STEP"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Index, func(t *testing.T) {
+			selection, err := processLogVersionsConfig(test.Input)
+			if err != nil {
+				t.Fatalf(`Error msg: %s`, err)
+			}
+
+			selected := selectLogVersions(selection, available)
+			t.Logf(`Expected : %#v`, test.Expected)
+			t.Logf(`Selected : %#v`, selected)
+
+			if !slices.Equal(selected, test.Expected) {
+				t.Fail()
+			}
+		})
+	}
+}
+
 func TestConfigurationStageParsing(t *testing.T) {
 
 	tests := []struct {
@@ -132,8 +180,14 @@ func TestConnectionFile(t *testing.T) {
 		{"12", "12.testdata", ConnectionOptions{}},
 		{"13", "13.testdata", ConnectionOptions{}},
 		{"14", "14.testdata", ConnectionOptions{Hostname: "http://YANDEX.loc", Username: "TESTUSER", Password: "PASSWORD"}},
+		{"15", "15.testdata", ConnectionOptions{Hostname: "https://yandex.loc:50001", Username: "TESTUSER", Password: "PASSWORD"}},
+		{"16", "16.testdata", ConnectionOptions{Hostname: "https://yandex.loc:50001", Username: "TESTUSER", Password: "from env"}},
+		{"17", "17.testdata", ConnectionOptions{}},
+		{"18", "18.testdata", ConnectionOptions{Hostname: "https://yandex.loc:50001", Username: "TESTUSER", Password: "env:DOWNLOADER_TEST_PASSWORD"}},
 	}
 
+	t.Setenv("DOWNLOADER_TEST_PASSWORD", "from env")
+
 	for _, test := range tests {
 		t.Run(test.Index, getComparerConnect(test.Filename, test.Expected))
 	}
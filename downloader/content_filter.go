@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	SelectorKindXPath    string = "xpath"
+	SelectorKindJSONPath        = "jsonpath"
+	SelectorKindRegex           = "regex"
+)
+
+// ContentPredicate is -match condition evaluated on unpacked payloads, e.g.
+// regex:4500012345, xpath://OrderNumber=4500012345 or jsonpath:$.orderNumber
+type ContentPredicate struct {
+	Expression string
+	Path       PayloadPath    // xpath and jsonpath predicates
+	Value      string         // value of the path, any value if empty
+	Pattern    *regexp.Regexp // regex predicates
+}
+
+// hits of each -match predicate and number of versions matched by it
+var matchHits, matchVersions namedCounter
+
+// parseContentSelector parses <kind>:<expression> used by -match and -redact
+func parseContentSelector(selector string) (PayloadPath, *regexp.Regexp, error) {
+	kind, expression, _ := strings.Cut(selector, ":")
+
+	switch strings.ToLower(kind) {
+	case SelectorKindXPath, SelectorKindJSONPath:
+		if strings.HasPrefix(strings.TrimSpace(expression), "$") != strings.EqualFold(kind, SelectorKindJSONPath) {
+			return PayloadPath{}, nil, fmt.Errorf("[%s] is not a %s expression", expression, strings.ToLower(kind))
+		}
+		path, err := parsePayloadPath(expression)
+		return path, nil, err
+	case SelectorKindRegex:
+		pattern, err := regexp.Compile(expression)
+		if err != nil {
+			return PayloadPath{}, nil, fmt.Errorf("regular expression [%s] is incorrect: %s", expression, err)
+		}
+		return PayloadPath{}, pattern, nil
+	default:
+		return PayloadPath{}, nil, fmt.Errorf("unsupported kind [%s], use xpath:, jsonpath: or regex:", kind)
+	}
+}
+
+func parseContentPredicate(input string) (ContentPredicate, error) {
+	predicate := ContentPredicate{Expression: strings.TrimSpace(input)}
+
+	selector := predicate.Expression
+	if !strings.HasPrefix(strings.ToLower(selector), SelectorKindRegex+":") {
+		selector, predicate.Value, _ = strings.Cut(selector, "=")
+		predicate.Value = strings.TrimSpace(predicate.Value)
+	}
+
+	path, pattern, err := parseContentSelector(selector)
+	if err != nil {
+		return ContentPredicate{}, fmt.Errorf("Content filter [%s] is incorrect: %s", input, err)
+	}
+	predicate.Path = path
+	predicate.Pattern = pattern
+
+	return predicate, nil
+}
+
+// count returns number of values found by predicate, path predicates are applied
+// only to XML or JSON contents
+func (p ContentPredicate) count(ext string, data []byte) int {
+	if p.Pattern != nil {
+		return len(p.Pattern.FindAllIndex(data, -1))
+	}
+
+	if (ext != ".xml" && ext != ".json") || p.Path.IsJSON() != (ext == ".json") {
+		return 0
+	}
+
+	matches, err := p.Path.Find(data)
+	if err != nil {
+		// broken payloads are reported by unpacker
+		return 0
+	}
+
+	count := 0
+	for _, match := range matches {
+		if p.Value == "" || strings.TrimSpace(match.Value) == p.Value {
+			count++
+		}
+	}
+	return count
+}
+
+// matchPayloads returns number of hits of each -match predicate in payloads (including
+// extracted ones). Predicates without hits are not included.
+func matchPayloads(predicates []ContentPredicate, payloads *XIMessagePayloads) map[string]int {
+	hits := make(map[string]int)
+
+	for _, part := range payloads.Parts {
+		if part.Kind != PayloadKindPayload {
+			continue
+		}
+
+		ext, _ := inferExtension(part.ContentType, part.Contents)
+		if slices.Contains(embeddedAutoExtensions, ext) {
+			continue
+		}
+
+		for _, predicate := range predicates {
+			if n := predicate.count(ext, part.Contents); n > 0 {
+				hits[predicate.Expression] += n
+			}
+		}
+	}
+
+	return hits
+}
+
+// filterPayloads evaluates -match predicates. Versions without hits are filtered out,
+// unless message already matched on the probe version (-matchfirst).
+func filterPayloads(options RuntimeConfiguration, entry XIMessageVersion, payloads *XIMessagePayloads) {
+	if len(options.MatchPredicates) == 0 || entry.DownloadError != nil {
+		// failed download is reported, whether it would match is unknown
+		return
+	}
+
+	payloads.Matches = matchPayloads(options.MatchPredicates, payloads)
+	payloads.FilteredOut = len(payloads.Matches) == 0 && !entry.MessageMatched
+
+	for expression, n := range payloads.Matches {
+		matchHits.Add(expression, n)
+		matchVersions.Add(expression, 1)
+	}
+	if len(payloads.Matches) > 0 {
+		atomic.AddInt32(&statistics.VersionsMatched, 1)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseContentPredicate(t *testing.T) {
+	tests := []struct {
+		Index string
+		Input string
+		Value string
+		Error bool
+	}{
+		{"01", "regex:4500012345", "", false},
+		{"02", "regex:a=b", "", false},
+		{"03", "xpath://OrderNumber=4500012345", "4500012345", false},
+		{"04", "XPATH://Customer/IBAN", "", false},
+		{"05", "jsonpath:$.customer.iban = GB82WEST12345698765432", "GB82WEST12345698765432", false},
+		{"06", "jsonpath://Customer", "", true},
+		{"07", "xpath:$.customer", "", true},
+		{"08", "regex:(", "", true},
+		{"09", "4500012345", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Index, func(t *testing.T) {
+			predicate, err := parseContentPredicate(test.Input)
+			t.Logf(`Predicate: %#v, error: %v`, predicate, err)
+
+			if (err != nil) != test.Error || predicate.Value != test.Value {
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestFilterPayloads(t *testing.T) {
+	quietDiagnostics = true
+	defer func() { quietDiagnostics = false }()
+
+	tests := []struct {
+		Index       string
+		Filename    string
+		Predicates  []string
+		Matched     bool // message matched on another version
+		Hits        int
+		FilteredOut bool
+	}{
+		{"01", "01.async.xml.testdata", []string{"regex:4500012345"}, false, 1, false},
+		{"02", "01.async.xml.testdata", []string{"regex:4500099999"}, false, 0, true},
+		{"03", "01.async.xml.testdata", []string{"regex:4500099999"}, true, 0, false},
+		{"04", "01.async.xml.testdata", []string{"xpath://Customer/Name=Jane Doe", "regex:M-\\d+"}, false, 2, false},
+		{"05", "01.async.xml.testdata", []string{"xpath://Customer/Name=John Roe"}, false, 0, true},
+		{"06", "04.lf.json.testdata", []string{"xpath://OrderNumber", "jsonpath:$..material"}, false, 1, false},
+		{"07", "03.attachments.testdata", []string{"regex:Bestellung", "regex:PDF"}, false, 1, false},
+		{"08", "04.lf.json.testdata", []string{"regex:BC_WEBSHOP"}, false, 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Index, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", "messages", test.Filename))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			options := RuntimeConfiguration{}
+			for _, input := range test.Predicates {
+				predicate, err := parseContentPredicate(input)
+				if err != nil {
+					t.Fatal(err)
+				}
+				options.MatchPredicates = append(options.MatchPredicates, predicate)
+			}
+
+			entry := testMessageVersion()
+			entry.MessageMatched = test.Matched
+			payloads := UnpackParts(options, entry, data)
+			filterPayloads(options, entry, &payloads)
+
+			hits := 0
+			for _, n := range payloads.Matches {
+				hits += n
+			}
+			t.Logf(`Matches: %#v`, payloads.Matches)
+
+			if hits != test.Hits || payloads.FilteredOut != test.FilteredOut {
+				t.Fail()
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"slices"
+	"sync/atomic"
+)
+
+// deduplicator remembers written payloads by SHA-256 of contents (-dedup). Used by
+// one FileWriter goroutine, so it is not thread-safe.
+type deduplicator struct {
+	enabled bool
+	seen    map[[sha256.Size]byte]string // digest to path of the first copy
+	stats   *Statistics
+}
+
+func newDeduplicator(options RuntimeConfiguration, stats *Statistics) *deduplicator {
+	return &deduplicator{
+		enabled: options.Deduplicate,
+		seen:    make(map[[sha256.Size]byte]string),
+		stats:   stats,
+	}
+}
+
+// Original returns path of the earlier written file with the same contents
+func (d *deduplicator) Original(contents []byte, path string) (string, bool) {
+	if !d.enabled || len(contents) == 0 {
+		return "", false
+	}
+
+	original, ok := d.seen[sha256.Sum256(contents)]
+	// same file written again is not a duplicate
+	return original, ok && original != path
+}
+
+// Written remembers path for the next identical payloads. Called only after the file
+// was written successfully, so duplicates never refer to a missing file.
+func (d *deduplicator) Written(contents []byte, path string) {
+	if !d.enabled || len(contents) == 0 {
+		return
+	}
+
+	digest := sha256.Sum256(contents)
+	if _, ok := d.seen[digest]; !ok {
+		d.seen[digest] = path
+	}
+}
+
+// markDuplicate records reference to the original in the manifest notes
+func (d *deduplicator) markDuplicate(item XIPayload, original string, saved int64) XIPayload {
+	atomic.AddInt32(&d.stats.DuplicateFiles, 1)
+	atomic.AddInt64(&d.stats.DuplicateBytesSaved, saved)
+
+	item.Notes = append(slices.Clip(item.Notes), fmt.Sprintf("duplicate-of:%s", original))
+	return item
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestDeduplicator(t *testing.T) {
+	tests := []struct {
+		Index     string
+		Enabled   bool
+		Contents  string
+		Path      string
+		Written   bool // write of the file succeeded
+		Original  string
+		Duplicate bool
+	}{
+		{"01", true, "<a/>", "LOG.BI/1.MainDocument", true, "", false},
+		{"02", true, "<a/>", "LOG.MS/1.MainDocument", true, "LOG.BI/1.MainDocument", true},
+		{"03", true, "<b/>", "LOG.MS/1.Attachment", true, "", false},
+		{"04", true, "<a/>", "LOG.BI/1.MainDocument", true, "LOG.BI/1.MainDocument", false},
+		{"05", true, "", "LOG.BI/1.Empty", true, "", false},
+		{"06", true, "", "LOG.MS/1.Empty", true, "", false},
+		{"07", false, "<a/>", "LOG.AM/1.MainDocument", true, "", false},
+		{"08", true, "<c/>", "LOG.BI/1.Failed", false, "", false},
+		{"09", true, "<c/>", "LOG.MS/1.Failed", true, "", false},
+		{"10", true, "<c/>", "LOG.AM/1.Failed", true, "LOG.MS/1.Failed", true},
+	}
+
+	enabled := newDeduplicator(RuntimeConfiguration{Deduplicate: true}, &Statistics{})
+	disabled := newDeduplicator(RuntimeConfiguration{}, &Statistics{})
+
+	for _, test := range tests {
+		t.Run(test.Index, func(t *testing.T) {
+			dedup := disabled
+			if test.Enabled {
+				dedup = enabled
+			}
+
+			original, duplicate := dedup.Original([]byte(test.Contents), test.Path)
+			t.Logf(`Original: %s, duplicate: %v`, original, duplicate)
+			if !duplicate && test.Written {
+				dedup.Written([]byte(test.Contents), test.Path)
+			}
+
+			if original != test.Original || duplicate != test.Duplicate {
+				t.Fail()
+			}
+		})
+	}
+}
@@ -1,104 +1,157 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"slices"
 	"strconv"
 	"sync/atomic"
+	"time"
 )
 
 const (
 	QoS_BestEffort string = "BE"
 )
 
-func Downloader(options RuntimeConfiguration, connect ConnectionOptions, msgChannel <-chan XIAdapterMessage, versionChan chan<- XIMessageVersion) {
+// versionRequest is a message version selected for download by -stage and -log
+type versionRequest struct {
+	Type VersionType
+	Name string
+}
+
+func Downloader(options RuntimeConfiguration, connect ConnectionOptions, export *Export, msgChannel <-chan XIAdapterMessage, versionChan chan<- XIMessageVersion) {
 	defer wgDownloaders.Done()
 
 	for msg := range msgChannel {
+		if export.Interrupted() {
+			// remaining messages are skipped, the export is finished as partial
+			continue
+		}
 
-		if msg.QualityOfService != QoS_BestEffort && len(options.SaveStagingVersions) > 0 {
-			// staged is requested and possible
+		requests := selectVersionRequests(options, msg)
+		probe := options.MatchFirstVersion && len(options.MatchPredicates) > 0
+		matched := false
 
-			var versionsToDownload []string
-			allVersions := []string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11", "12", "13", "14", "15"}
-			// this is an overdoing but 5 must be enough
+		for i, request := range requests {
+			version, ok, err := downloadVersion(connect, msg, request)
+			if errors.Is(err, errAuthentication) {
+				// writers close archives, export is left as partial
+				export.Abort(err)
+				break
+			}
+			if err != nil {
+				// reported as diagnostic of the version, the next one is still tried
+				atomic.AddInt32(&statistics.VersionsDownloadFailed, 1)
+				versionChan <- version
+				continue
+			}
+			if !ok {
+				continue
+			}
 
-			if slices.Equal(options.SaveStagingVersions, []string{StageVersionSpecialAll}) {
-				// ALL
-				i, _ := strconv.Atoi(msg.Version)
-				if i > 15 {
-					// safeguard
-					i = 15
+			if probe {
+				// the first downloaded version decides on the whole message
+				probe = false
+				payloads := unpackMeasured(options, version)
+				if payloads.FilteredOut {
+					atomic.AddInt32(&statistics.VersionsFilteredOut, 1)
+					atomic.AddInt32(&statistics.VersionsNotDownloaded, int32(len(requests)-i-1))
+					break
 				}
-				versionsToDownload = allVersions[:i+1]
-			} else if slices.Equal(options.SaveStagingVersions, []string{StageVersionSpecialLast}) {
-				// LAST
-				versionsToDownload = []string{msg.Version}
-			} else {
-				// all specified manually by user
-				versionsToDownload = options.SaveStagingVersions
+				matched = true
+				version.Unpacked = &payloads
 			}
 
-			maxAvailableVersion, _ := strconv.Atoi(msg.Version)
-			for _, versionName := range versionsToDownload {
-				requestedVersion, _ := strconv.Atoi(versionName)
+			version.MessageMatched = matched
+			versionChan <- version
+		}
+		atomic.AddInt32(&statistics.MessagesDownloaded, 1)
+	}
+}
 
-				if maxAvailableVersion < requestedVersion {
-					// skip
-					continue
-				}
+// selectVersionRequests returns staged versions followed by logged versions of the message
+func selectVersionRequests(options RuntimeConfiguration, msg XIAdapterMessage) []versionRequest {
+	requests := []versionRequest{}
 
-				envelop := downloadStagedVersion(connect, msg.MessageKey, versionName)
+	if msg.QualityOfService != QoS_BestEffort && len(options.SaveStagingVersions) > 0 {
+		// staged is requested and possible
 
-				if len(envelop) > 0 {
-					versionChan <- XIMessageVersion{
-						MessageInfo:    msg,
-						VersionType:    VersionTypeStaged,
-						MessageVersion: versionName,
-						Base64Contents: envelop,
-					}
+		var versionsToDownload []string
+		allVersions := []string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11", "12", "13", "14", "15"}
+		// this is an overdoing but 5 must be enough
 
-					atomic.AddInt64(&statistics.NetworkBytesDownloaded, int64(len(envelop)))
-				}
+		if slices.Equal(options.SaveStagingVersions, []string{StageVersionSpecialAll}) {
+			// ALL
+			i, _ := strconv.Atoi(msg.Version)
+			if i > 15 {
+				// safeguard
+				i = 15
 			}
-
+			versionsToDownload = allVersions[:i+1]
+		} else if slices.Equal(options.SaveStagingVersions, []string{StageVersionSpecialLast}) {
+			// LAST
+			versionsToDownload = []string{msg.Version}
+		} else {
+			// all specified manually by user
+			versionsToDownload = options.SaveStagingVersions
 		}
 
-		if len(options.SaveLoggingVersions) > 0 {
+		maxAvailableVersion, _ := strconv.Atoi(msg.Version)
+		for _, versionName := range versionsToDownload {
+			requestedVersion, _ := strconv.Atoi(versionName)
 
-			var logVersionsToDownload []string
-			if slices.Equal(options.SaveLoggingVersions, []string{LogVersionSpecialAll}) {
-				logVersionsToDownload = msg.LogLocations.String
-			} else {
-				logVersionsToDownload = options.SaveLoggingVersions
+			if maxAvailableVersion < requestedVersion {
+				// skip
+				continue
 			}
+			requests = append(requests, versionRequest{VersionTypeStaged, versionName})
+		}
+	}
 
-			for _, versionName := range logVersionsToDownload {
-
-				if slices.Index(msg.LogLocations.String, versionName) == -1 {
-					// skip non-existant
-					continue
-				}
+	if len(options.SaveLoggingVersions) > 0 {
+		recordLogVersionHits(options.SaveLoggingVersions, msg.LogLocations.String)
+		for _, versionName := range selectLogVersions(options.SaveLoggingVersions, msg.LogLocations.String) {
+			requests = append(requests, versionRequest{VersionTypeLogged, versionName})
+		}
+	}
 
-				envelop := downloadLoggedVersion(connect, msg.MessageKey, versionName)
+	return requests
+}
 
-				if len(envelop) > 0 {
-					versionChan <- XIMessageVersion{
-						MessageInfo:    msg,
-						VersionType:    VersionTypeLogged,
-						MessageVersion: versionName,
-						Base64Contents: envelop,
-					}
+// downloadVersion returns false if version is empty. Version which cannot be downloaded
+// is returned together with the error in DownloadError.
+func downloadVersion(connect ConnectionOptions, msg XIAdapterMessage, request versionRequest) (XIMessageVersion, bool, error) {
+	started := time.Now()
+
+	var envelop string
+	var err error
+	if request.Type == VersionTypeStaged {
+		envelop, err = downloadStagedVersion(connect, msg.MessageKey, request.Name)
+	} else {
+		envelop, err = downloadLoggedVersion(connect, msg.MessageKey, request.Name)
+	}
+	stageDownload.Add(len(envelop), started)
+
+	version := XIMessageVersion{
+		MessageInfo:    msg,
+		VersionType:    request.Type,
+		MessageVersion: request.Name,
+		Base64Contents: envelop,
+		DownloadError:  err,
+	}
+	if err != nil {
+		return version, false, err
+	}
 
-					atomic.AddInt64(&statistics.NetworkBytesDownloaded, int64(len(envelop)))
-				}
-			}
-		}
-		atomic.AddInt32(&statistics.MessagesDownloaded, 1)
+	if len(envelop) == 0 {
+		return XIMessageVersion{}, false, nil
 	}
+	atomic.AddInt64(&statistics.NetworkBytesDownloaded, int64(len(envelop)))
+
+	return version, true, nil
 }
 
-func downloadStagedVersion(connect ConnectionOptions, messageKey string, versionName string) string {
+func downloadStagedVersion(connect ConnectionOptions, messageKey string, versionName string) (string, error) {
 
 	requestTemplate := fmt.Sprintf(`<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:urn="urn:AdapterMessageMonitoringVi">
    <soapenv:Header/>
@@ -111,12 +164,12 @@ func downloadStagedVersion(connect ConnectionOptions, messageKey string, version
    </soapenv:Body>
 </soapenv:Envelope>`, messageKey, versionName)
 
-	httpResults := downloadGeneric(connect, requestTemplate)
+	httpResults, err := downloadGeneric(connect, requestTemplate)
 
-	return httpResults.Body.GetMessageBytesJavaLangStringIntBooleanResponse.Response
+	return httpResults.Body.GetMessageBytesJavaLangStringIntBooleanResponse.Response, err
 }
 
-func downloadLoggedVersion(connect ConnectionOptions, messageKey string, messageVersion string) string {
+func downloadLoggedVersion(connect ConnectionOptions, messageKey string, messageVersion string) (string, error) {
 
 	requestTemplate := fmt.Sprintf(`<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:urn="urn:AdapterMessageMonitoringVi">
    <soapenv:Header/>
@@ -129,7 +182,7 @@ func downloadLoggedVersion(connect ConnectionOptions, messageKey string, message
    </soapenv:Body>
 </soapenv:Envelope>`, messageKey, messageVersion)
 
-	httpResults := downloadGeneric(connect, requestTemplate)
+	httpResults, err := downloadGeneric(connect, requestTemplate)
 
-	return httpResults.Body.GetLoggedMessageBytesResponse.Response
+	return httpResults.Body.GetLoggedMessageBytesResponse.Response, err
 }
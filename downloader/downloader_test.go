@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDownloadVersion(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		body := string(data)
+
+		switch {
+		case strings.Contains(body, "<urn:messageKey>401</urn:messageKey>"):
+			w.WriteHeader(http.StatusUnauthorized)
+		case strings.Contains(body, "<urn:messageKey>500</urn:messageKey>"):
+			w.WriteHeader(http.StatusInternalServerError)
+		case strings.Contains(body, "<urn:messageKey>html</urn:messageKey>"):
+			w.Write([]byte("<html><body>Logon</body>"))
+		case strings.Contains(body, "<urn:messageKey>empty</urn:messageKey>"):
+			w.Write([]byte(`<SOAP-ENV:Envelope xmlns:SOAP-ENV="http://schemas.xmlsoap.org/soap/envelope/"><SOAP-ENV:Body/></SOAP-ENV:Envelope>`))
+		default:
+			w.Write([]byte(`<SOAP-ENV:Envelope xmlns:SOAP-ENV="http://schemas.xmlsoap.org/soap/envelope/"><SOAP-ENV:Body>` +
+				`<rpl:getLoggedMessageBytesResponse xmlns:rpl="urn:AdapterMessageMonitoringVi"><rpl:Response>UkFX</rpl:Response></rpl:getLoggedMessageBytesResponse>` +
+				`</SOAP-ENV:Body></SOAP-ENV:Envelope>`))
+		}
+	}))
+	defer server.Close()
+
+	initiateHTTPClient(RuntimeConfiguration{})
+	connect := ConnectionOptions{Hostname: server.URL, Username: "user", Password: "password"}
+
+	tests := []struct {
+		Index          string
+		MessageKey     string
+		Downloaded     bool
+		Error          bool
+		Authentication bool
+	}{
+		{"01", "ok", true, false, false},
+		{"02", "empty", false, false, false},
+		{"03", "500", false, true, false},
+		{"04", "html", false, true, false},
+		{"05", "401", false, true, true},
+	}
+
+	quiet := quietDiagnostics
+	quietDiagnostics = true
+	defer func() { quietDiagnostics = quiet }()
+
+	for _, test := range tests {
+		t.Run(test.Index, func(t *testing.T) {
+			msg := XIAdapterMessage{MessageID: "id", MessageKey: test.MessageKey}
+			version, ok, err := downloadVersion(connect, msg, versionRequest{VersionTypeLogged, "BI"})
+			t.Logf(`Downloaded: %v, contents: %s, error: %v`, ok, version.Base64Contents, err)
+
+			if ok != test.Downloaded || (err != nil) != test.Error || errors.Is(err, errAuthentication) != test.Authentication {
+				t.FailNow()
+			}
+
+			// failed version is reported in the export
+			if err != nil {
+				payloads := unpackMeasured(RuntimeConfiguration{}, version)
+				t.Logf(`Diagnostics: %#v`, payloads.Diagnostics)
+
+				if payloads.MessageID != "id" || len(payloads.Diagnostics) != 1 || len(payloads.Parts) != 0 {
+					t.Fail()
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	ExportManifestFilename       string = "manifest.csv"
+	DynamicConfigurationFilename        = "dynamic_configuration.csv"
+	MatchesFilename                     = "matches.csv"
+)
+
+// ExportManifest maps every written file to the message entry and version it came from.
+// Written by each FileWriter mode as the last file of the export, together with other
+// cross-message files (see Files).
+type ExportManifest struct {
+	entries []ManifestEntry
+
+	// values of selected dynamic configuration keys, one row per message version
+	dynamicConfigurationKeys []string
+	dynamicConfiguration     [][]string
+
+	// hits of -match predicates, one row per predicate and message version
+	matchPredicates []ContentPredicate
+	matches         [][]string
+
+	versionsSeen map[string]bool
+}
+
+type ExportFile struct {
+	Filename string
+	Contents []byte
+}
+
+func newExportManifest(options RuntimeConfiguration) *ExportManifest {
+	return &ExportManifest{
+		dynamicConfigurationKeys: options.DynamicConfiguration,
+		matchPredicates:          options.MatchPredicates,
+		versionsSeen:             make(map[string]bool),
+	}
+}
+
+type ManifestEntry struct {
+	Path              string
+	Size              int64
+	SHA256            string // of payload contents, before compression of -zip modes
+	MessageID         string
+	MessageKey        string
+	EntryName         string
+	Direction         string
+	SenderComponent   string
+	ReceiverComponent string
+	Interface         string
+	VersionType       string
+	Version           string
+	Part              string
+	Kind              PayloadKind
+	Notes             []string
+}
+
+// AddVersion records the message version once: dynamic configuration, -match hits and
+// problems found while unpacking (row of kind "diagnostics" without path). Called by
+// writers for every version, including versions without files.
+func (m *ExportManifest) AddVersion(entry XIMessagePayloads) {
+	version := entry.Message.MessageKey + "|" + entry.VersionID
+	if m.versionsSeen[version] {
+		return
+	}
+	m.versionsSeen[version] = true
+	m.addDynamicConfiguration(entry)
+	m.addMatches(entry)
+
+	if len(entry.Diagnostics) > 0 {
+		m.entries = append(m.entries, m.newEntry(entry, XIPayload{Kind: PayloadKindDiagnostics, Notes: entry.Diagnostics}, ""))
+	}
+}
+
+func (m *ExportManifest) Add(entry XIMessagePayloads, item XIPayload, path string) {
+	m.AddVersion(entry)
+
+	m.entries = append(m.entries, m.newEntry(entry, item, path))
+}
+
+func (m *ExportManifest) newEntry(entry XIMessagePayloads, item XIPayload, path string) ManifestEntry {
+	versionType, _, _ := strings.Cut(entry.VersionID, ".")
+	digest := sha256.Sum256(item.Contents)
+	checksum := hex.EncodeToString(digest[:])
+	if item.Kind == PayloadKindDiagnostics {
+		checksum = ""
+	}
+
+	return ManifestEntry{
+		Path:              path,
+		Size:              int64(len(item.Contents)),
+		SHA256:            checksum,
+		MessageID:         entry.Message.MessageID,
+		MessageKey:        entry.Message.MessageKey,
+		EntryName:         entryName(entry.Message),
+		Direction:         entry.Message.Direction,
+		SenderComponent:   entry.Message.SenderName,
+		ReceiverComponent: entry.Message.ReceiverName,
+		Interface:         firstNonEmpty(entry.Message.Interface.Name, entry.Message.ReceiverInterface.Name),
+		VersionType:       versionType,
+		Version:           entry.VersionID,
+		Part:              item.Name,
+		Kind:              item.Kind,
+		Notes:             item.Notes,
+	}
+}
+
+func (m *ExportManifest) addDynamicConfiguration(entry XIMessagePayloads) {
+	if len(m.dynamicConfigurationKeys) == 0 || entry.Header == nil {
+		return
+	}
+
+	row := []string{entry.Message.MessageID, entry.Message.MessageKey, entryName(entry.Message), entry.VersionID}
+	for _, key := range m.dynamicConfigurationKeys {
+		row = append(row, entry.Header.DynamicConfigurationValue(key))
+	}
+	m.dynamicConfiguration = append(m.dynamicConfiguration, row)
+}
+
+func (m *ExportManifest) addMatches(entry XIMessagePayloads) {
+	for _, predicate := range m.matchPredicates {
+		if hits := entry.Matches[predicate.Expression]; hits > 0 {
+			m.matches = append(m.matches, []string{entry.Message.MessageID, entry.Message.MessageKey, entryName(entry.Message), entry.VersionID, predicate.Expression, strconv.Itoa(hits)})
+		}
+	}
+}
+
+func (m *ExportManifest) Len() int {
+	return len(m.entries)
+}
+
+func (m *ExportManifest) CSV() []byte {
+	buffer := new(bytes.Buffer)
+	w := csv.NewWriter(buffer)
+
+	_ = w.Write([]string{"path", "size", "sha256", "message_id", "message_key", "entry", "direction", "sender_component", "receiver_component", "interface", "version_type", "version", "part", "kind", "notes"})
+	for _, e := range m.entries {
+		_ = w.Write([]string{e.Path, strconv.FormatInt(e.Size, 10), e.SHA256, e.MessageID, e.MessageKey, e.EntryName, e.Direction, e.SenderComponent, e.ReceiverComponent, e.Interface, e.VersionType, e.Version, e.Part, string(e.Kind), strings.Join(e.Notes, "; ")})
+	}
+
+	w.Flush()
+	return buffer.Bytes()
+}
+
+func (m *ExportManifest) DynamicConfigurationCSV() []byte {
+	buffer := new(bytes.Buffer)
+	w := csv.NewWriter(buffer)
+
+	_ = w.Write(append([]string{"message_id", "message_key", "entry", "version"}, m.dynamicConfigurationKeys...))
+	_ = w.WriteAll(m.dynamicConfiguration)
+
+	return buffer.Bytes()
+}
+
+func (m *ExportManifest) MatchesCSV() []byte {
+	buffer := new(bytes.Buffer)
+	w := csv.NewWriter(buffer)
+
+	_ = w.Write([]string{"message_id", "message_key", "entry", "version", "match", "hits"})
+	_ = w.WriteAll(m.matches)
+
+	return buffer.Bytes()
+}
+
+// Files returns manifest and other cross-message files to be written at the end of export
+func (m *ExportManifest) Files() []ExportFile {
+	if m.Len() == 0 {
+		return nil
+	}
+
+	files := []ExportFile{{ExportManifestFilename, m.CSV()}}
+	if len(m.dynamicConfigurationKeys) > 0 {
+		files = append(files, ExportFile{DynamicConfigurationFilename, m.DynamicConfigurationCSV()})
+	}
+	if len(m.matchPredicates) > 0 {
+		files = append(files, ExportFile{MatchesFilename, m.MatchesCSV()})
+	}
+	return files
+}
+
+// payloadPath returns path of the payload relative to the export root
+func payloadPath(folder string, filename string) string {
+	folder = strings.Trim(folder, "/")
+	if folder == "" {
+		return filename
+	}
+	return fmt.Sprintf("%s/%s", folder, filename)
+}
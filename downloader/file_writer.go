@@ -3,83 +3,341 @@ package main
 import (
 	"errors"
 	"fmt"
+	"io"
 	"net/url"
 	"os"
 	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
-var ExportComment string
+const (
+	PartialSuffix     string = ".partial"
+	PartialMarkerName        = "export" + PartialSuffix
+)
 
-func prepareFileWriter(options RuntimeConfiguration, connect ConnectionOptions) error {
-	if options.StatisticsOnly {
-		// nothing to do here
+// partialOutput is a file written under temporary .partial name, see Export.Finish
+type partialOutput struct {
+	Name   string // final name
+	Marker bool   // marker of -zip none and file export, removed on success
+}
+
+// Export is the state of one export, created by prepareFileWriter: output folder,
+// partial files and interruption. The rest of the pipeline still works with package
+// variables (statistics, wait groups of launcher.go, stage counters, archiveStdout,
+// quietDiagnostics, redactionHits, matchHits, matchVersions, HTTP client), so only one
+// export can run in a process at a time.
+type Export struct {
+	Comment string      // comment of ZIP, GZIP and SQLite, also written to export.partial
+	Key     string      // folder of the export below -output, used for S3 object keys
+	Stats   *Statistics // written and uploaded files are counted here
+
+	// written by FileWriter goroutine, read after wgWriters.Wait()
+	partialOutputs []partialOutput
+	writerError    error
+
+	// set on Ctrl+C or SIGTERM: no new messages are processed, messages in progress are
+	// written and export is left as .partial
+	interrupted atomic.Bool
+
+	// fatal error of a downloader (e.g. wrong password): export is stopped as on Ctrl+C
+	abortError error
+	abortLock  sync.Mutex
+}
+
+// Interrupted reports that no new messages must be processed
+func (e *Export) Interrupted() bool {
+	return e.interrupted.Load()
+}
+
+// original standard output, console messages are written to stderr with -stdout
+var archiveStdout = os.Stdout
+
+// payloadTime returns modification time of files of the message: start time of the
+// message in -timezone, current time if message has no timestamp
+func payloadTime(options RuntimeConfiguration, msg XIAdapterMessage) time.Time {
+	if t := messageTime(msg, options.TimeZone); !t.IsZero() {
+		return t
+	}
+	return time.Now()
+}
+
+// setFileTime sets modification time of the file written to disk, failure is not fatal
+func setFileTime(name string, modified time.Time) {
+	if err := os.Chtimes(name, modified, modified); err != nil {
+		fmt.Printf("Cannot set modification time of file [%s]: %s\n", name, err)
+	}
+}
+
+// countingWriter counts bytes written to archives which cannot be checked with Stat (stdout)
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// stdoutRequested checks command-line for -stdout before it is parsed, so that
+// nothing is printed to stdout before the archive
+func stdoutRequested(args []string) bool {
+	for _, arg := range args {
+		switch arg {
+		case "-stdout", "--stdout", "-stdout=true", "--stdout=true":
+			return true
+		}
+	}
+	return false
+}
+
+// createArchive creates export archive file named after the message list, or returns
+// stdout with -stdout
+func (e *Export) createArchive(options RuntimeConfiguration, extension string) (*os.File, string, error) {
+	if options.ArchiveToStdout {
+		return archiveStdout, "stdout", nil
+	}
+
+	newFilename := filepath.Join(options.OutputRoot, archiveName(options, extension))
+	file, err := e.createPartial(newFilename)
+	return file, newFilename, err
+}
+
+// closeArchive flushes the archive to disk and closes it. Error of either means the
+// archive is incomplete (e.g. disk is full), so it must not be renamed by Finish.
+func closeArchive(file *os.File, name string) error {
+	if file == archiveStdout {
 		return nil
 	}
 
-	if options.OutputDirectory == "" {
-		return errors.New("Destination directory is not specified")
+	err := file.Sync()
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
 	}
+	if err != nil {
+		return fmt.Errorf("Fail on file close [%s]: %s", name, err)
+	}
+	return nil
+}
 
-	url, err := url.Parse(connect.Hostname)
+func archiveName(options RuntimeConfiguration, extension string) string {
+	if options.MessageListFilename != "" {
+		return options.MessageListFilename + extension
+	}
+	return "export" + extension
+}
+
+// createPartial creates file with .partial suffix. It is renamed by Finish once export
+// completes, so interrupted export is never mistaken for a complete one.
+func (e *Export) createPartial(name string) (*os.File, error) {
+	file, err := os.Create(name + PartialSuffix)
 	if err != nil {
-		return errors.New(fmt.Sprintf("Cannot parse hostname: %s", err))
+		return nil, fmt.Errorf("Failed creating file [%s]: %s", name+PartialSuffix, err)
 	}
+	e.partialOutputs = append(e.partialOutputs, partialOutput{Name: name})
+	return file, nil
+}
 
-	dt := time.Now().Format("20060102150405")
-	dtcomment := time.Now().Format("2006-01-02 15:04:05")
+// markPartial creates marker file for exports written file by file
+func (e *Export) markPartial(root string) error {
+	name := filepath.Join(root, PartialMarkerName)
+	text := fmt.Sprintf("Export is incomplete: it was interrupted or failed. This file is removed when export completes.\n%s\n", e.Comment)
+	err := os.WriteFile(name, []byte(text), 0666)
+	if err != nil {
+		return fmt.Errorf("Failed creating file [%s]: %s", name, err)
+	}
+	e.partialOutputs = append(e.partialOutputs, partialOutput{Name: name, Marker: true})
+	return nil
+}
+
+// Finish renames .partial files to their final names if export completed. Otherwise
+// they are left as is and error is returned.
+func (e *Export) Finish() error {
+	err := e.writerError
+	if err == nil {
+		e.abortLock.Lock()
+		err = e.abortError
+		e.abortLock.Unlock()
+	}
+	if err == nil && e.Interrupted() {
+		err = errors.New("Export was interrupted")
+	}
+	if err != nil {
+		if len(e.partialOutputs) > 0 {
+			return fmt.Errorf("%s. Export is incomplete and marked with %s suffix", err, PartialSuffix)
+		}
+		return err
+	}
+
+	for _, output := range e.partialOutputs {
+		if output.Marker {
+			err = os.Remove(output.Name)
+		} else {
+			err = os.Rename(output.Name+PartialSuffix, output.Name)
+		}
+		if err != nil {
+			return fmt.Errorf("Cannot complete export file [%s]: %s", output.Name, err)
+		}
+	}
+	return nil
+}
 
-	path := fmt.Sprintf("%s/%s/%s/", options.OutputDirectory, url.Hostname(), dt)
+// Abort stops the export on fatal error: no new messages are downloaded, messages in
+// progress are written and archives are closed, Finish returns the error
+func (e *Export) Abort(err error) {
+	e.abortLock.Lock()
+	defer e.abortLock.Unlock()
 
-	err = os.MkdirAll(path, 0750)
+	if e.abortError == nil {
+		e.abortError = err
+		fmt.Printf("Error: %s, finishing messages in progress\n", err)
+	}
+	e.interrupted.Store(true)
+}
+
+// handleInterrupt lets the first Ctrl+C finish messages in progress, so that archives
+// are closed properly. The second one exits immediately.
+func handleInterrupt(export *Export) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-signals
+		export.interrupted.Store(true)
+		fmt.Println("Interrupted: finishing messages in progress, press Ctrl+C again to exit immediately")
+
+		<-signals
+		os.Exit(130)
+	}()
+}
+
+// sourceName returns name of the source system used in output path and ZIP comment
+func sourceName(connect ConnectionOptions) (string, error) {
+	url, err := url.Parse(connect.Hostname)
 	if err != nil {
-		return errors.New(fmt.Sprintf("Cannot create output directory [%s]: %s", path, err))
+		return "", errors.New(fmt.Sprintf("Cannot parse hostname: %s", err))
 	}
+	return url.Hostname(), nil
+}
 
-	err = os.Chdir(path)
+// prepareFileWriter creates export folder from -output and -outputpath and sets OutputRoot.
+// All writers create files relative to OutputRoot.
+func prepareFileWriter(options *RuntimeConfiguration, source string) (*Export, error) {
+	export := &Export{Stats: &statistics}
+	if options.StatisticsOnly {
+		// nothing to do here
+		return export, nil
+	}
+
+	if options.OutputDirectory == "" {
+		return nil, errors.New("Destination directory is not specified")
+	}
+
+	started := time.Now()
+	export.Comment = fmt.Sprintf("Source      : %s\nExtracted on: %s", source, started.Format("2006-01-02 15:04:05"))
+	if options.EncryptionKey != nil {
+		export.Comment += "\nEncryption  : AES-256, files are opened with key in 7-Zip or WinZip"
+	}
+
+	if options.ArchiveToStdout {
+		// nothing is written to disk
+		return export, nil
+	}
+
+	export.Key = expandOutputPath(firstNonEmpty(options.OutputPath, OutputPathDefault), outputPathValues{
+		Host:    source,
+		SID:     options.SID,
+		Started: started,
+		IDFile:  options.MessageListFilename,
+	})
+	options.OutputRoot = filepath.Join(options.OutputDirectory, filepath.FromSlash(export.Key))
+
+	err := os.MkdirAll(options.OutputRoot, 0750)
 	if err != nil {
-		return errors.New(fmt.Sprintf("Cannot change current directory to [%s]: %s", path, err))
+		return nil, errors.New(fmt.Sprintf("Cannot create output directory [%s]: %s", options.OutputRoot, err))
 	}
 
-	ExportComment = fmt.Sprintf("Source      : %s\nExtracted on: %s", url.Hostname(), dtcomment)
+	// -outputpath without {timestamp} gives the same folder on every run. Files of the
+	// previous export would be mixed in, uploaded with -s3 and reported by verify.
+	entries, err := os.ReadDir(options.OutputRoot)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot read output directory [%s]: %s", options.OutputRoot, err)
+	}
+	if len(entries) > 0 {
+		return nil, fmt.Errorf("Output directory [%s] is not empty, use {%s} in -outputpath to export into a new folder", options.OutputRoot, OutputTokenTimestamp)
+	}
 
-	return nil
+	return export, nil
 }
 
-func FileWriter(options RuntimeConfiguration, version <-chan XIMessagePayloads) {
+// FileWriter runs writer of the -zip mode. If writer fails, the rest of versions is
+// discarded so that previous stages can finish.
+func FileWriter(options RuntimeConfiguration, export *Export, version <-chan XIMessagePayloads) {
 	defer wgWriters.Done()
 
+	var err error
 	switch options.ZipMode {
 	case ZipNone:
-		FileWriterModeNone(options, version)
+		err = FileWriterModeNone(options, export, version)
 	case ZipFile:
-		FileWriterModeFile(options, version)
+		err = FileWriterModeFile(options, export, version)
 	case ZipAll:
-		FileWriterModeAll(options, version)
+		if options.SplitMode != SplitNone {
+			err = FileWriterModeSplit(options, export, version)
+		} else {
+			err = FileWriterModeAll(options, export, version)
+		}
+	case ZipTar:
+		err = FileWriterModeTar(options, export, version, false)
+	case ZipTgz:
+		err = FileWriterModeTar(options, export, version, true)
+	case ZipSQLite:
+		err = FileWriterModeSQLite(options, export, version)
 	default:
 		panic("not supported ZipMode: " + options.ZipMode)
 	}
 
+	if err != nil {
+		fmt.Printf("Error writing export: %s\n", err)
+		export.writerError = err
+		for range version {
+			// discard
+		}
+	}
 }
 
 func openTargetDirectory(options RuntimeConfiguration) {
 
-	if options.OpenTargetDirectory == true {
-		cmd := exec.Command("explorer", ".")
+	if options.OpenTargetDirectory == true && !options.ArchiveToStdout {
+		cmd := exec.Command("explorer", options.OutputRoot)
 		_ = cmd.Run()
 	}
 
 }
 
-func createPath(folder string) string {
+func createPath(folder string) (string, error) {
 	if folder == "" {
-		return "."
+		return ".", nil
 	}
 
 	err := os.MkdirAll(folder, 0750)
 	if err != nil {
-		fmt.Printf("Cannot create folder [%s] for export\n", folder)
-		os.Exit(7)
+		return folder, fmt.Errorf("Cannot create folder [%s] for export: %s", folder, err)
+	}
+	return folder, nil
+}
+
+func writeManifestFiles(root string, manifest *ExportManifest) {
+	for _, file := range manifest.Files() {
+		err := os.WriteFile(filepath.Join(root, file.Filename), file.Contents, 0666)
+		if err != nil {
+			fmt.Printf("Error writing file [%s] to disk: %s\n", file.Filename, err)
+		}
 	}
-	return folder
 }
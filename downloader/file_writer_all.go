@@ -3,64 +3,78 @@ package main
 import (
 	"archive/zip"
 	"fmt"
-	"os"
 	"sync/atomic"
+	"time"
 )
 
 ///////////////// MODE ALL ///////////////
 
-func FileWriterModeAll(options RuntimeConfiguration, version <-chan XIMessagePayloads) {
+func FileWriterModeAll(options RuntimeConfiguration, export *Export, version <-chan XIMessagePayloads) error {
 
-	newFilename := "export.zip"
-	if options.MessageListFilename != "" {
-		newFilename = options.MessageListFilename + ".zip"
-	}
-
-	file, err := os.Create(newFilename)
+	file, newFilename, err := export.createArchive(options, ".zip")
 	if err != nil {
-		fmt.Printf("Failed creating file [%s]: %s\n", newFilename, err)
-		os.Exit(7)
+		return err
 	}
-	defer file.Close()
+	counter := &countingWriter{w: file}
 
 	// Create a new zip archive.
-	w := zip.NewWriter(file)
-	defer w.Close()
+	w := zip.NewWriter(counter)
 
 	if options.NoComment == false {
-		err = w.SetComment(ExportComment)
+		err := w.SetComment(export.Comment)
 		if err != nil {
-			fmt.Printf("Failed creating file [%s]: %s\n", newFilename, err)
-			os.Exit(8)
+			closeArchive(file, newFilename)
+			return fmt.Errorf("Failed creating file [%s]: %s", newFilename, err)
 		}
 	}
 
+	manifest := newExportManifest(options)
+	dedup := newDeduplicator(options, export.Stats)
+
 	for entry := range version {
+		started := time.Now()
+		modified := payloadTime(options, entry.Message)
+		manifest.AddVersion(entry)
 
 		for _, item := range entry.Parts {
-			fullpath := fmt.Sprintf("%s/%s", entry.Folder, item.Filename)
-			f, err := w.Create(fullpath)
-			if err != nil {
-				fmt.Printf("Failed writing file [%s] to ZIP: %s\n", fullpath, err)
+			fullpath := payloadPath(entry.Folder, item.Filename)
+			if original, ok := dedup.Original(item.Contents, fullpath); ok {
+				// only manifest refers to the duplicate
+				manifest.Add(entry, dedup.markDuplicate(item, original, int64(len(item.Contents))), fullpath)
 				continue
 			}
 
-			_, err = f.Write(item.Contents)
+			err := writeZipEntry(w, fullpath, item.Contents, modified, options.EncryptionKey)
 			if err != nil {
 				fmt.Printf("Failed writing file [%s] to ZIP: %s\n", fullpath, err)
 				continue
 			}
+
+			dedup.Written(item.Contents, fullpath)
+			manifest.Add(entry, item, fullpath)
+		}
+
+		stageWrite.Add(entry.Size(), started)
+	}
+
+	for _, file := range manifest.Files() {
+		err := writeZipEntry(w, file.Filename, file.Contents, time.Now(), options.EncryptionKey)
+		if err != nil {
+			fmt.Printf("Failed writing file [%s] to ZIP: %s\n", file.Filename, err)
 		}
 	}
 
 	// Make sure to check the error on Close.
 	err = w.Close()
 	if err != nil {
-		fmt.Printf("Fail on ZIP file close [%s]: %s\n", newFilename, err)
-		return
+		closeArchive(file, newFilename)
+		return fmt.Errorf("Fail on ZIP file close [%s]: %s", newFilename, err)
+	}
+	if err := closeArchive(file, newFilename); err != nil {
+		return err
 	}
 
-	stats, _ := file.Stat()
-	atomic.AddInt64(&statistics.DiskBytesWritten, stats.Size())
-	atomic.AddInt32(&statistics.FilesWrittenToDisk, 1)
+	atomic.AddInt64(&export.Stats.DiskBytesWritten, counter.n)
+	atomic.AddInt32(&export.Stats.FilesWrittenToDisk, 1)
+	return nil
 }
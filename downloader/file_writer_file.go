@@ -4,30 +4,76 @@ import (
 	"compress/gzip"
 	"fmt"
 	"os"
+	"path/filepath"
 	"sync/atomic"
+	"time"
 )
 
 ///////// MODE: FILE /////////////////
 
-func FileWriterModeFile(options RuntimeConfiguration, version <-chan XIMessagePayloads) {
+func FileWriterModeFile(options RuntimeConfiguration, export *Export, version <-chan XIMessagePayloads) error {
+
+	if err := export.markPartial(options.OutputRoot); err != nil {
+		return err
+	}
+
+	manifest := newExportManifest(options)
+	dedup := newDeduplicator(options, export.Stats)
 
 	for entry := range version {
-		path := createPath(entry.Folder)
+		started := time.Now()
+		modified := payloadTime(options, entry.Message)
+		manifest.AddVersion(entry)
+		path, err := createPath(filepath.Join(options.OutputRoot, entry.Folder))
+		if err != nil {
+			return err
+		}
 		for _, item := range entry.Parts {
+			relative := payloadPath(entry.Folder, item.Filename+".gz")
+			if original, ok := dedup.Original(item.Contents, relative); ok {
+				newFilename := filepath.Join(options.OutputRoot, relative)
+				if _, err := createPath(filepath.Dir(newFilename)); err != nil {
+					return err
+				}
+				err := os.Link(filepath.Join(options.OutputRoot, original), newFilename)
+				if err == nil {
+					saved := int64(0)
+					if stats, err := os.Stat(newFilename); err == nil {
+						saved = stats.Size()
+					}
+					atomic.AddInt32(&export.Stats.FilesWrittenToDisk, 1)
+					manifest.Add(entry, dedup.markDuplicate(item, original, saved), relative)
+					continue
+				}
+				// file system without hard links, a copy is written
+				fmt.Printf("Cannot create hard link [%s] to [%s]: %s\n", relative, original, err)
+			}
 
-			bytesDisk, ok := FileWriterWriteGZIP(options, item, path)
+			bytesDisk, ok := FileWriterWriteGZIP(options, item, path, modified)
 
-			atomic.AddInt32(&statistics.FilesWrittenToDisk, ok)
-			atomic.AddInt64(&statistics.DiskBytesWritten, bytesDisk)
+			atomic.AddInt32(&export.Stats.FilesWrittenToDisk, ok)
+			atomic.AddInt64(&export.Stats.DiskBytesWritten, bytesDisk)
+			if ok > 0 {
+				dedup.Written(item.Contents, relative)
+				manifest.Add(entry, item, relative)
+			}
 		}
+
+		stageWrite.Add(entry.Size(), started)
 	}
 
+	writeManifestFiles(options.OutputRoot, manifest)
+	return nil
 }
 
 // return bytes written to disk, payload size and number of files
-func FileWriterWriteGZIP(options RuntimeConfiguration, item XIPayload, path string) (int64, int32) {
+func FileWriterWriteGZIP(options RuntimeConfiguration, item XIPayload, path string, modified time.Time) (int64, int32) {
 
 	newFilename := fmt.Sprintf("%s/%s.gz", path, item.Filename)
+	if _, err := createPath(filepath.Dir(newFilename)); err != nil {
+		fmt.Println(err)
+		return 0, 0
+	}
 
 	file, err := os.Create(newFilename)
 	if err != nil {
@@ -37,6 +83,7 @@ func FileWriterWriteGZIP(options RuntimeConfiguration, item XIPayload, path stri
 	defer file.Close()
 
 	gzipWriter := gzip.NewWriter(file)
+	gzipWriter.ModTime = modified
 
 	_, err = gzipWriter.Write(item.Contents)
 	if err != nil {
@@ -51,5 +98,7 @@ func FileWriterWriteGZIP(options RuntimeConfiguration, item XIPayload, path stri
 	}
 
 	stats, _ := file.Stat()
+	file.Close() // before setting time, deferred Close is no-op
+	setFileTime(newFilename, modified)
 	return int64(stats.Size()), 1
 }
@@ -3,28 +3,66 @@ package main
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"sync/atomic"
+	"time"
 )
 
 ///////// MODE: NONE /////////////////
 
-func FileWriterModeNone(options RuntimeConfiguration, version <-chan XIMessagePayloads) {
+func FileWriterModeNone(options RuntimeConfiguration, export *Export, version <-chan XIMessagePayloads) error {
+
+	if err := export.markPartial(options.OutputRoot); err != nil {
+		return err
+	}
+
+	manifest := newExportManifest(options)
+	dedup := newDeduplicator(options, export.Stats)
 
 	for entry := range version {
+		started := time.Now()
+		modified := payloadTime(options, entry.Message)
+		manifest.AddVersion(entry)
 
-		path := createPath(entry.Folder)
+		path, err := createPath(filepath.Join(options.OutputRoot, entry.Folder))
+		if err != nil {
+			return err
+		}
 
 		for _, item := range entry.Parts {
 			newFilename := fmt.Sprintf("%s/%s", path, item.Filename)
+			if _, err := createPath(filepath.Dir(newFilename)); err != nil {
+				return err
+			}
+
+			relative := payloadPath(entry.Folder, item.Filename)
+			if original, ok := dedup.Original(item.Contents, relative); ok {
+				err := os.Link(filepath.Join(options.OutputRoot, original), newFilename)
+				if err == nil {
+					atomic.AddInt32(&export.Stats.FilesWrittenToDisk, 1)
+					manifest.Add(entry, dedup.markDuplicate(item, original, int64(len(item.Contents))), relative)
+					continue
+				}
+				// file system without hard links, a copy is written
+				fmt.Printf("Cannot create hard link [%s] to [%s]: %s\n", newFilename, original, err)
+			}
+
 			err := os.WriteFile(newFilename, item.Contents, 0666)
 			if err != nil {
 				fmt.Printf("Error writing file [%s] to disk: %s", item.Filename, err)
 				continue
 			}
+			setFileTime(newFilename, modified)
 
-			atomic.AddInt32(&statistics.FilesWrittenToDisk, 1)
-			atomic.AddInt64(&statistics.DiskBytesWritten, int64(len(item.Contents)))
+			atomic.AddInt32(&export.Stats.FilesWrittenToDisk, 1)
+			atomic.AddInt64(&export.Stats.DiskBytesWritten, int64(len(item.Contents)))
+			dedup.Written(item.Contents, relative)
+			manifest.Add(entry, item, relative)
 		}
+
+		stageWrite.Add(entry.Size(), started)
 	}
 
+	writeManifestFiles(options.OutputRoot, manifest)
+	return nil
 }
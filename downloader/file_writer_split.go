@@ -0,0 +1,332 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"encoding/csv"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+///////////////// MODE ALL, SPLIT ///////////////
+
+type ArchiveSplitMode string
+
+const (
+	SplitNone    ArchiveSplitMode = ""
+	SplitMessage                  = "msg"
+	SplitFolder                   = "folder"
+	SplitSize                     = "size"
+)
+
+const ArchiveIndexFilename string = "archives.csv"
+
+// split archives kept open at the same time, older ones are closed and continued
+// in a new archive if needed
+const maxOpenVolumes int = 256
+
+// rough size of ZIP headers of one entry besides its name
+const zipEntryOverhead int64 = 128
+
+var splitSizeRegexp = regexp.MustCompile(`(?i)^(\d+)\s*(mb|m)?$`)
+
+func processSplitFlag(input string) (ArchiveSplitMode, int64, error) {
+	input = strings.TrimSpace(input)
+
+	switch strings.ToLower(input) {
+	case "", "none":
+		return SplitNone, 0, nil
+	case SplitMessage:
+		return SplitMessage, 0, nil
+	case SplitFolder:
+		return SplitFolder, 0, nil
+	}
+
+	match := splitSizeRegexp.FindStringSubmatch(input)
+	if match == nil {
+		return SplitNone, 0, fmt.Errorf("Split option [%s] is unknown. Use msg, folder or size in MB (e.g. 20MB)", input)
+	}
+
+	size, err := strconv.ParseInt(match[1], 10, 64)
+	if err != nil || size < 1 {
+		return SplitNone, 0, fmt.Errorf("Split size [%s] must be positive number of MB", input)
+	}
+	return SplitSize, size * 1024 * 1024, nil
+}
+
+// zipVolume is one of split archives
+type zipVolume struct {
+	export   *Export
+	name     string
+	file     *os.File
+	counter  *countingWriter
+	w        *zip.Writer
+	entries  int
+	lastUsed int
+}
+
+type zipEntry struct {
+	header     *zip.FileHeader
+	compressed []byte
+}
+
+func openZipVolume(options RuntimeConfiguration, export *Export, name string) (*zipVolume, error) {
+	file, err := export.createPartial(filepath.Join(options.OutputRoot, name))
+	if err != nil {
+		return nil, err
+	}
+
+	counter := &countingWriter{w: file}
+	volume := &zipVolume{export: export, name: name, file: file, counter: counter, w: zip.NewWriter(counter)}
+
+	if options.NoComment == false {
+		err = volume.w.SetComment(export.Comment)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("Failed creating file [%s]: %s", name, err)
+		}
+	}
+	return volume, nil
+}
+
+func (v *zipVolume) Close() error {
+	err := v.w.Close()
+	closeErr := closeArchive(v.file, v.name)
+	if err != nil {
+		return fmt.Errorf("Fail on ZIP file close [%s]: %s", v.name, err)
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+
+	atomic.AddInt64(&v.export.Stats.DiskBytesWritten, v.counter.n)
+	atomic.AddInt32(&v.export.Stats.FilesWrittenToDisk, 1)
+	return nil
+}
+
+// size returns approximate size of the archive if entries are added
+func (v *zipVolume) size(entries []zipEntry) int64 {
+	size := v.counter.n + int64(len(v.export.Comment))
+	for _, entry := range entries {
+		size += int64(len(entry.compressed)) + zipEntryOverhead + 2*int64(len(entry.header.Name))
+	}
+	return size
+}
+
+// compressZipEntry deflates contents in advance, so that size of the archive is known
+// before the entry is added
+func compressZipEntry(name string, contents []byte, modified time.Time) (zipEntry, error) {
+	buffer := new(bytes.Buffer)
+	w, err := flate.NewWriter(buffer, flate.DefaultCompression)
+	if err != nil {
+		return zipEntry{}, err
+	}
+	if _, err = w.Write(contents); err != nil {
+		return zipEntry{}, err
+	}
+	if err = w.Close(); err != nil {
+		return zipEntry{}, err
+	}
+
+	header := &zip.FileHeader{
+		Name:               name,
+		Method:             zip.Deflate,
+		CRC32:              crc32.ChecksumIEEE(contents),
+		CompressedSize64:   uint64(buffer.Len()),
+		UncompressedSize64: uint64(len(contents)),
+	}
+	setZipModified(header, modified)
+	return zipEntry{header, buffer.Bytes()}, nil
+}
+
+// extended timestamp extra field, written by zip.Writer.CreateHeader
+const zipExtraTimestamp uint16 = 0x5455
+
+// setZipModified sets modification time of entry for CreateRaw, which unlike CreateHeader
+// ignores FileHeader.Modified: MS-DOS time in location of modified and extended
+// timestamp (UTC) for 7-Zip, unzip and Go readers
+func setZipModified(header *zip.FileHeader, modified time.Time) {
+	header.Modified = modified
+	header.ModifiedDate = uint16(modified.Day() + int(modified.Month())<<5 + (modified.Year()-1980)<<9)
+	header.ModifiedTime = uint16(modified.Second()/2 + modified.Minute()<<5 + modified.Hour()<<11)
+
+	extra := binary.LittleEndian.AppendUint16(nil, zipExtraTimestamp)
+	extra = binary.LittleEndian.AppendUint16(extra, 5)
+	extra = append(extra, 1) // only modification time
+	extra = binary.LittleEndian.AppendUint32(extra, uint32(modified.Unix()))
+	header.Extra = append(header.Extra, extra...)
+}
+
+// FileWriterModeSplit writes -zip all export into several archives (-split): one per
+// message, one per folder or volumes of limited size. Versions are never split
+// between archives. archives.csv lists archive of every message version.
+func FileWriterModeSplit(options RuntimeConfiguration, export *Export, version <-chan XIMessagePayloads) error {
+
+	base := archiveName(options, "")
+
+	manifest := newExportManifest(options)
+	dedup := newDeduplicator(options, export.Stats)
+
+	volumes := make(map[string]*zipVolume)
+	continued := make(map[string]int) // number of archives created for the key
+	index := [][]string{}
+	sequence := 0
+
+	for entry := range version {
+		started := time.Now()
+		modified := payloadTime(options, entry.Message)
+		manifest.AddVersion(entry)
+		sequence++
+
+		entries := []zipEntry{}
+		items := []XIPayload{}
+		for _, item := range entry.Parts {
+			fullpath := payloadPath(entry.Folder, item.Filename)
+			if original, ok := dedup.Original(item.Contents, fullpath); ok {
+				// only manifest refers to the duplicate
+				manifest.Add(entry, dedup.markDuplicate(item, original, int64(len(item.Contents))), fullpath)
+				continue
+			}
+
+			zipped, err := prepareZipEntry(fullpath, item.Contents, modified, options.EncryptionKey)
+			if err != nil {
+				fmt.Printf("Failed writing file [%s] to ZIP: %s\n", fullpath, err)
+				continue
+			}
+			entries = append(entries, zipped)
+			items = append(items, item)
+		}
+		if len(entries) == 0 {
+			stageWrite.Add(entry.Size(), started)
+			continue
+		}
+
+		key := ""
+		switch options.SplitMode {
+		case SplitMessage:
+			key = generateFilename(entry.MessageID)
+		case SplitFolder:
+			key = generateFilename(strings.ReplaceAll(strings.Trim(entry.Folder, "/"), "/", "_"))
+		}
+
+		volume := volumes[key]
+		if volume != nil && options.SplitMode == SplitSize && volume.entries > 0 && volume.size(entries) > options.SplitSize {
+			// next volume
+			delete(volumes, key)
+			if err := volume.Close(); err != nil {
+				closeVolumes(volumes)
+				return err
+			}
+			volume = nil
+		}
+
+		if volume == nil {
+			continued[key]++
+			opened, err := openZipVolume(options, export, splitArchiveName(base, key, options.SplitMode, continued[key]))
+			if err != nil {
+				closeVolumes(volumes)
+				return err
+			}
+			volume = opened
+			volumes[key] = volume
+
+			if len(volumes) > maxOpenVolumes {
+				if err := closeOldestVolume(volumes); err != nil {
+					closeVolumes(volumes)
+					return err
+				}
+			}
+		}
+		volume.lastUsed = sequence
+
+		for i, zipped := range entries {
+			f, err := volume.w.CreateRaw(zipped.header)
+			if err == nil {
+				_, err = f.Write(zipped.compressed)
+			}
+			if err != nil {
+				fmt.Printf("Failed writing file [%s] to ZIP: %s\n", zipped.header.Name, err)
+				continue
+			}
+
+			volume.entries++
+			dedup.Written(items[i].Contents, zipped.header.Name)
+			manifest.Add(entry, items[i], zipped.header.Name)
+		}
+
+		index = append(index, []string{volume.name, entry.Message.MessageID, entry.Message.MessageKey, entryName(entry.Message), entry.VersionID, strconv.Itoa(len(entries))})
+		stageWrite.Add(entry.Size(), started)
+	}
+
+	if err := closeVolumes(volumes); err != nil {
+		return err
+	}
+
+	writeManifestFiles(options.OutputRoot, manifest)
+
+	buffer := new(bytes.Buffer)
+	w := csv.NewWriter(buffer)
+	_ = w.Write([]string{"archive", "message_id", "message_key", "entry", "version", "files"})
+	_ = w.WriteAll(index)
+
+	err := os.WriteFile(filepath.Join(options.OutputRoot, ArchiveIndexFilename), buffer.Bytes(), 0666)
+	if err != nil {
+		fmt.Printf("Error writing file [%s] to disk: %s\n", ArchiveIndexFilename, err)
+	}
+	return nil
+}
+
+// splitArchiveName returns e.g. export.001.zip for volumes, export.<message ID>.zip for
+// messages. Archive continued after it was closed gets sequence number as well.
+func splitArchiveName(base string, key string, mode ArchiveSplitMode, count int) string {
+	if mode == SplitSize {
+		return fmt.Sprintf("%s.%03d.zip", base, count)
+	}
+
+	name := base
+	if key != "" {
+		name += "." + key
+	}
+	if count > 1 {
+		name += fmt.Sprintf(".%d", count)
+	}
+	return name + ".zip"
+}
+
+func closeOldestVolume(volumes map[string]*zipVolume) error {
+	// empty key is a valid one (messages without folder), so it can't mark "not found"
+	var oldest *zipVolume
+	oldestKey := ""
+	for key, volume := range volumes {
+		if oldest == nil || volume.lastUsed < oldest.lastUsed {
+			oldest, oldestKey = volume, key
+		}
+	}
+
+	if oldest == nil {
+		return nil
+	}
+	delete(volumes, oldestKey)
+	return oldest.Close()
+}
+
+// closeVolumes closes all volumes, returns the first error
+func closeVolumes(volumes map[string]*zipVolume) error {
+	var result error
+	for key, volume := range volumes {
+		if err := volume.Close(); err != nil && result == nil {
+			result = err
+		}
+		delete(volumes, key)
+	}
+	return result
+}
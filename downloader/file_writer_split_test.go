@@ -0,0 +1,101 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestProcessSplitFlag(t *testing.T) {
+	tests := []struct {
+		Index string
+		Input string
+		Mode  ArchiveSplitMode
+		Size  int64
+		Error bool
+	}{
+		{"01", "", SplitNone, 0, false},
+		{"02", "msg", SplitMessage, 0, false},
+		{"03", "Folder", SplitFolder, 0, false},
+		{"04", "100MB", SplitSize, 100 * 1024 * 1024, false},
+		{"05", "5 mb", SplitSize, 5 * 1024 * 1024, false},
+		{"06", "20", SplitSize, 20 * 1024 * 1024, false},
+		{"07", "0MB", SplitNone, 0, true},
+		{"08", "1GB", SplitNone, 0, true},
+		{"09", "version", SplitNone, 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Index, func(t *testing.T) {
+			mode, size, err := processSplitFlag(test.Input)
+			t.Logf(`Mode: %q, size: %d, error: %v`, mode, size, err)
+
+			if mode != test.Mode || size != test.Size || (err != nil) != test.Error {
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestSplitArchiveName(t *testing.T) {
+	tests := []struct {
+		Index  string
+		Mode   ArchiveSplitMode
+		Key    string
+		Count  int
+		Result string
+	}{
+		{"01", SplitSize, "", 1, "export.001.zip"},
+		{"02", SplitSize, "", 12, "export.012.zip"},
+		{"03", SplitMessage, "6b1c3e2e-8a11-11ee-b8d6-00000c9d89ea", 1, "export.6b1c3e2e-8a11-11ee-b8d6-00000c9d89ea.zip"},
+		{"04", SplitFolder, "LOG.BI", 2, "export.LOG.BI.2.zip"},
+		{"05", SplitFolder, "", 1, "export.zip"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Index, func(t *testing.T) {
+			result := splitArchiveName("export", test.Key, test.Mode, test.Count)
+			t.Logf(`Result: %s`, result)
+
+			if result != test.Result {
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestCloseOldestVolume(t *testing.T) {
+	options := RuntimeConfiguration{OutputRoot: t.TempDir(), NoComment: true}
+	export := &Export{Stats: &Statistics{}}
+
+	tests := []struct {
+		Index  string
+		Used   map[string]int
+		Closed string
+	}{
+		{"01", map[string]int{"LOG.BI": 3, "": 1, "LOG.AM": 2}, ""},
+		{"02", map[string]int{"LOG.BI": 3, "": 4, "LOG.AM": 2}, "LOG.AM"},
+		{"03", map[string]int{"": 1}, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Index, func(t *testing.T) {
+			volumes := map[string]*zipVolume{}
+			for key, used := range test.Used {
+				volume, err := openZipVolume(options, export, test.Index+"."+key+".zip")
+				if err != nil {
+					t.Fatal(err)
+				}
+				volume.lastUsed = used
+				volumes[key] = volume
+			}
+			defer closeVolumes(volumes)
+
+			err := closeOldestVolume(volumes)
+			_, open := volumes[test.Closed]
+			t.Logf(`Open volumes: %d, error: %v`, len(volumes), err)
+
+			if err != nil || open || len(volumes) != len(test.Used)-1 {
+				t.Fail()
+			}
+		})
+	}
+}
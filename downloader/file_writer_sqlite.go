@@ -0,0 +1,287 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+///////////////// MODE SQLITE ///////////////
+
+// versions written in one transaction
+const sqliteBatchSize int = 500
+
+// payloads_view joins all tables, e.g.
+// SELECT * FROM payloads_view WHERE version = 'LOG.AM' AND interface = 'SI_Order_Out' AND size > 1048576
+const sqliteSchema string = `
+CREATE TABLE export (
+	name  TEXT PRIMARY KEY,
+	value TEXT
+);
+CREATE TABLE messages (
+	message_key         TEXT PRIMARY KEY,
+	message_id          TEXT NOT NULL,
+	entry               TEXT,
+	direction           TEXT,
+	status              TEXT,
+	quality_of_service  TEXT,
+	start_time          TEXT,
+	end_time            TEXT,
+	sender_party        TEXT,
+	sender_component    TEXT,
+	receiver_party      TEXT,
+	receiver_component  TEXT,
+	interface           TEXT,
+	interface_namespace TEXT
+);
+CREATE TABLE versions (
+	id           INTEGER PRIMARY KEY,
+	message_key  TEXT NOT NULL REFERENCES messages(message_key),
+	version      TEXT NOT NULL,
+	version_type TEXT,
+	folder       TEXT,
+	header_json  TEXT,
+	diagnostics  TEXT
+);
+CREATE TABLE blobs (
+	sha256   TEXT PRIMARY KEY,
+	contents BLOB NOT NULL
+);
+CREATE TABLE payloads (
+	id           INTEGER PRIMARY KEY,
+	version_id   INTEGER NOT NULL REFERENCES versions(id),
+	path         TEXT NOT NULL,
+	part         TEXT,
+	kind         TEXT,
+	content_type TEXT,
+	size         INTEGER NOT NULL,
+	sha256       TEXT NOT NULL REFERENCES blobs(sha256),
+	notes        TEXT
+);
+CREATE TABLE dynamic_configuration (
+	version_id INTEGER NOT NULL REFERENCES versions(id),
+	namespace  TEXT,
+	name       TEXT,
+	value      TEXT
+);
+CREATE TABLE matches (
+	version_id INTEGER NOT NULL REFERENCES versions(id),
+	expression TEXT,
+	hits       INTEGER
+);
+CREATE INDEX messages_message_id ON messages(message_id);
+CREATE INDEX messages_interface ON messages(interface);
+CREATE INDEX messages_sender ON messages(sender_component);
+CREATE INDEX messages_receiver ON messages(receiver_component);
+CREATE INDEX messages_start_time ON messages(start_time);
+CREATE INDEX versions_message_key ON versions(message_key, version);
+CREATE INDEX versions_version ON versions(version);
+CREATE INDEX payloads_version_id ON payloads(version_id);
+CREATE INDEX payloads_part ON payloads(part);
+CREATE INDEX payloads_size ON payloads(size);
+CREATE INDEX payloads_sha256 ON payloads(sha256);
+CREATE INDEX dynamic_configuration_name ON dynamic_configuration(name, value);
+CREATE VIEW payloads_view AS
+SELECT m.message_id, m.message_key, m.entry, m.direction, m.status, m.start_time,
+	m.sender_component, m.receiver_component, m.interface, v.version, v.version_type,
+	p.path, p.part, p.kind, p.content_type, p.size, p.sha256, p.notes, b.contents
+FROM payloads p
+JOIN versions v ON v.id = p.version_id
+JOIN messages m ON m.message_key = v.message_key
+JOIN blobs b ON b.sha256 = p.sha256;
+`
+
+// sqliteExport writes message metadata, versions and payloads to SQLite database (-zip sqlite).
+// Contents are stored once per SHA-256 in blobs table.
+type sqliteExport struct {
+	db      *sql.DB
+	tx      *sql.Tx
+	pending int
+}
+
+func openSQLiteExport(filename string) (*sqliteExport, error) {
+	db, err := sql.Open("sqlite", filename)
+	if err != nil {
+		return nil, err
+	}
+	// one writer. Rollback journal keeps the database of interrupted export readable.
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec("PRAGMA journal_mode = DELETE; PRAGMA synchronous = NORMAL;" + sqliteSchema)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqliteExport{db: db}, nil
+}
+
+func (e *sqliteExport) SetProperty(name string, value string) error {
+	_, err := e.db.Exec("INSERT OR REPLACE INTO export (name, value) VALUES (?, ?)", name, value)
+	return err
+}
+
+// Add writes message (once), version and its payloads. Version which cannot be written
+// is rolled back completely, the rest of the batch is kept.
+func (e *sqliteExport) Add(entry XIMessagePayloads) error {
+	if e.tx == nil {
+		tx, err := e.db.Begin()
+		if err != nil {
+			return err
+		}
+		e.tx = tx
+	}
+
+	_, err := e.tx.Exec("SAVEPOINT version")
+	if err != nil {
+		return err
+	}
+	err = e.insertVersion(entry)
+	if err != nil {
+		if _, rollbackErr := e.tx.Exec("ROLLBACK TO version; RELEASE version"); rollbackErr != nil {
+			return fmt.Errorf("%s, rollback failed: %s", err, rollbackErr)
+		}
+		return err
+	}
+	_, err = e.tx.Exec("RELEASE version")
+	if err != nil {
+		return err
+	}
+
+	e.pending++
+	if e.pending >= sqliteBatchSize {
+		return e.commit()
+	}
+	return nil
+}
+
+func (e *sqliteExport) insertVersion(entry XIMessagePayloads) error {
+	msg := entry.Message
+	_, err := e.tx.Exec(`INSERT OR IGNORE INTO messages VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		msg.MessageKey, msg.MessageID, entryName(msg), msg.Direction, msg.Status, msg.QualityOfService, msg.StartTime, msg.EndTime,
+		msg.SenderParty, msg.SenderName, msg.ReceiverParty, msg.ReceiverName,
+		firstNonEmpty(msg.Interface.Name, msg.ReceiverInterface.Name), firstNonEmpty(msg.Interface.Namespace, msg.ReceiverInterface.Namespace))
+	if err != nil {
+		return err
+	}
+
+	var header any
+	if entry.Header != nil {
+		if data, err := entry.Header.JSON(); err == nil {
+			header = string(data)
+		}
+	}
+
+	versionType, _, _ := strings.Cut(entry.VersionID, ".")
+	result, err := e.tx.Exec(`INSERT INTO versions (message_key, version, version_type, folder, header_json, diagnostics) VALUES (?, ?, ?, ?, ?, ?)`,
+		msg.MessageKey, entry.VersionID, versionType, entry.Folder, header, strings.Join(entry.Diagnostics, "; "))
+	if err != nil {
+		return err
+	}
+	versionID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	for _, item := range entry.Parts {
+		digest := sha256.Sum256(item.Contents)
+		checksum := hex.EncodeToString(digest[:])
+
+		_, err = e.tx.Exec(`INSERT OR IGNORE INTO blobs (sha256, contents) VALUES (?, ?)`, checksum, item.Contents)
+		if err == nil {
+			_, err = e.tx.Exec(`INSERT INTO payloads (version_id, path, part, kind, content_type, size, sha256, notes) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+				versionID, payloadPath(entry.Folder, item.Filename), item.Name, string(item.Kind), item.ContentType, len(item.Contents), checksum, strings.Join(item.Notes, "; "))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if entry.Header != nil {
+		for _, record := range entry.Header.DynamicConfiguration {
+			_, err = e.tx.Exec(`INSERT INTO dynamic_configuration VALUES (?, ?, ?, ?)`, versionID, record.Namespace, record.Name, record.Value)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for expression, hits := range entry.Matches {
+		_, err = e.tx.Exec(`INSERT INTO matches VALUES (?, ?, ?)`, versionID, expression, hits)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *sqliteExport) commit() error {
+	if e.tx == nil {
+		return nil
+	}
+	err := e.tx.Commit()
+	e.tx, e.pending = nil, 0
+	return err
+}
+
+func (e *sqliteExport) Close() error {
+	err := e.commit()
+	if closeErr := e.db.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func FileWriterModeSQLite(options RuntimeConfiguration, export *Export, version <-chan XIMessagePayloads) error {
+
+	newFilename := filepath.Join(options.OutputRoot, archiveName(options, ".db"))
+
+	// database is created by the driver, file is created in advance to be marked as partial
+	file, err := export.createPartial(newFilename)
+	if err != nil {
+		return err
+	}
+	file.Close()
+
+	db, err := openSQLiteExport(newFilename + PartialSuffix)
+	if err != nil {
+		return fmt.Errorf("Failed creating file [%s]: %s", newFilename, err)
+	}
+
+	if options.NoComment == false {
+		err = db.SetProperty("comment", export.Comment)
+		if err != nil {
+			db.Close()
+			return fmt.Errorf("Failed creating file [%s]: %s", newFilename, err)
+		}
+	}
+
+	for entry := range version {
+		started := time.Now()
+
+		err := db.Add(entry)
+		if err != nil {
+			fmt.Printf("Failed writing message [%s] version [%s] to database: %s\n", entry.MessageID, entry.VersionID, err)
+		}
+
+		stageWrite.Add(entry.Size(), started)
+	}
+
+	err = db.Close()
+	if err != nil {
+		return fmt.Errorf("Fail on database close [%s]: %s", newFilename, err)
+	}
+
+	if stats, err := os.Stat(newFilename + PartialSuffix); err == nil {
+		atomic.AddInt64(&export.Stats.DiskBytesWritten, stats.Size())
+	}
+	atomic.AddInt32(&export.Stats.FilesWrittenToDisk, 1)
+	return nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+func TestSQLiteExport(t *testing.T) {
+	message := XIAdapterMessage{MessageID: "id", MessageKey: "key", Interface: XIInterface{Name: "SI_Order_Out"}}
+	header := &XIHeader{DynamicConfiguration: []XIHeaderRecord{{Namespace: "http://sap.com/xi/XI/System/File", Name: "FileName", Value: "order.xml"}}}
+
+	versions := []XIMessagePayloads{
+		{VersionID: "LOG.BI", Message: message, Header: header, Parts: []XIPayload{
+			{Filename: "1.MainDocument", Name: "MainDocument", Kind: PayloadKindPayload, Contents: []byte("<a/>")},
+			{Filename: "1.Attachment", Name: "Attachment", Kind: PayloadKindPayload, Contents: []byte("<a/>")},
+		}},
+		{VersionID: "LOG.AM", Message: message, Matches: map[string]int{"regex:a": 1}, Parts: []XIPayload{
+			{Filename: "1.MainDocument", Name: "MainDocument", Kind: PayloadKindPayload, Contents: []byte("<b/>")},
+		}},
+	}
+
+	filename := filepath.Join(t.TempDir(), "export.db")
+	export, err := openSQLiteExport(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = export.db.Exec(`CREATE TRIGGER failed_part BEFORE INSERT ON payloads WHEN NEW.part = 'Failed' BEGIN SELECT RAISE(ABORT, 'part failed'); END`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, version := range versions {
+		if err := export.Add(version); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// second part fails, message, version and the first part are rolled back
+	failed := XIMessagePayloads{VersionID: "LOG.BI", Message: XIAdapterMessage{MessageID: "id2", MessageKey: "key2"}, Parts: []XIPayload{
+		{Filename: "1.MainDocument", Name: "MainDocument", Kind: PayloadKindPayload, Contents: []byte("<c/>")},
+		{Filename: "1.Failed", Name: "Failed", Kind: PayloadKindPayload, Contents: []byte("<d/>")},
+	}}
+	if err := export.Add(failed); err == nil {
+		t.Fatal(`Failed version is written`)
+	}
+	if err := export.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		Index  string
+		Query  string
+		Result int
+	}{
+		{"01", "SELECT COUNT(*) FROM messages", 1},
+		{"02", "SELECT COUNT(*) FROM versions", 2},
+		{"03", "SELECT COUNT(*) FROM payloads", 3},
+		{"04", "SELECT COUNT(*) FROM blobs", 2},
+		{"05", "SELECT COUNT(*) FROM payloads_view WHERE version = 'LOG.AM' AND interface = 'SI_Order_Out' AND size > 3", 1},
+		{"06", "SELECT COUNT(*) FROM dynamic_configuration WHERE name = 'FileName' AND value = 'order.xml'", 1},
+		{"07", "SELECT SUM(hits) FROM matches", 1},
+	}
+
+	db, err := sql.Open("sqlite", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, test := range tests {
+		t.Run(test.Index, func(t *testing.T) {
+			result := 0
+			err := db.QueryRow(test.Query).Scan(&result)
+			t.Logf(`Result: %d, error: %v`, result, err)
+
+			if err != nil || result != test.Result {
+				t.Fail()
+			}
+		})
+	}
+}
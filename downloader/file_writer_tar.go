@@ -0,0 +1,123 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"path"
+	"sync/atomic"
+	"time"
+)
+
+///////////////// MODE TAR, TGZ ///////////////
+
+func FileWriterModeTar(options RuntimeConfiguration, export *Export, version <-chan XIMessagePayloads, compress bool) error {
+
+	extension := ".tar"
+	if compress {
+		extension = ".tgz"
+	}
+
+	file, newFilename, err := export.createArchive(options, extension)
+	if err != nil {
+		return err
+	}
+	counter := &countingWriter{w: file}
+
+	var output io.Writer = counter
+	var gzipWriter *gzip.Writer
+	if compress {
+		gzipWriter = gzip.NewWriter(counter)
+		if options.NoComment == false {
+			gzipWriter.Comment = export.Comment
+		}
+		output = gzipWriter
+	}
+
+	w := tar.NewWriter(output)
+
+	manifest := newExportManifest(options)
+	dedup := newDeduplicator(options, export.Stats)
+	folders := make(map[string]bool)
+	modTime := time.Now()
+
+	for entry := range version {
+		started := time.Now()
+		modified := payloadTime(options, entry.Message)
+		manifest.AddVersion(entry)
+
+		for _, item := range entry.Parts {
+			fullpath := payloadPath(entry.Folder, item.Filename)
+			writeTarFolders(w, path.Dir(fullpath), folders, modTime)
+
+			if original, ok := dedup.Original(item.Contents, fullpath); ok {
+				err := w.WriteHeader(&tar.Header{Typeflag: tar.TypeLink, Name: fullpath, Linkname: original, Mode: 0644, ModTime: modified})
+				if err != nil {
+					fmt.Printf("Failed writing file [%s] to TAR: %s\n", fullpath, err)
+					continue
+				}
+				manifest.Add(entry, dedup.markDuplicate(item, original, int64(len(item.Contents))), fullpath)
+				continue
+			}
+
+			err := writeTarFile(w, fullpath, item.Contents, modified)
+			if err != nil {
+				fmt.Printf("Failed writing file [%s] to TAR: %s\n", fullpath, err)
+				continue
+			}
+
+			dedup.Written(item.Contents, fullpath)
+			manifest.Add(entry, item, fullpath)
+		}
+
+		stageWrite.Add(entry.Size(), started)
+	}
+
+	for _, file := range manifest.Files() {
+		err := writeTarFile(w, file.Filename, file.Contents, modTime)
+		if err != nil {
+			fmt.Printf("Failed writing file [%s] to TAR: %s\n", file.Filename, err)
+		}
+	}
+
+	err = w.Close()
+	if err == nil && gzipWriter != nil {
+		err = gzipWriter.Close()
+	}
+	if err != nil {
+		closeArchive(file, newFilename)
+		return fmt.Errorf("Fail on TAR file close [%s]: %s", newFilename, err)
+	}
+	if err := closeArchive(file, newFilename); err != nil {
+		return err
+	}
+
+	atomic.AddInt64(&export.Stats.DiskBytesWritten, counter.n)
+	atomic.AddInt32(&export.Stats.FilesWrittenToDisk, 1)
+	return nil
+}
+
+func writeTarFile(w *tar.Writer, name string, contents []byte, modTime time.Time) error {
+	err := w.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Size: int64(len(contents)), Mode: 0644, ModTime: modTime})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(contents)
+	return err
+}
+
+// writeTarFolders adds entries for the folder and its parents, so folders are created
+// with sane permissions on extraction
+func writeTarFolders(w *tar.Writer, folder string, written map[string]bool, modTime time.Time) {
+	if folder == "." || folder == "/" || written[folder] {
+		return
+	}
+	writeTarFolders(w, path.Dir(folder), written, modTime)
+
+	written[folder] = true
+	err := w.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: folder + "/", Mode: 0755, ModTime: modTime})
+	if err != nil {
+		fmt.Printf("Failed writing folder [%s] to TAR: %s\n", folder, err)
+	}
+}
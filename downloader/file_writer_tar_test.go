@@ -0,0 +1,53 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"path"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestWriteTar(t *testing.T) {
+	tests := []struct {
+		Index   string
+		Files   []string
+		Entries []string
+	}{
+		{"01", []string{"manifest.csv"}, []string{"manifest.csv"}},
+		{"02", []string{"LOG.BI/1.MainDocument", "LOG.BI/2.MainDocument"}, []string{"LOG.BI/", "LOG.BI/1.MainDocument", "LOG.BI/2.MainDocument"}},
+		{"03", []string{"a/b/c/1.xml", "a/d/2.xml"}, []string{"a/", "a/b/", "a/b/c/", "a/b/c/1.xml", "a/d/", "a/d/2.xml"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Index, func(t *testing.T) {
+			buffer := new(bytes.Buffer)
+			w := tar.NewWriter(buffer)
+			folders := make(map[string]bool)
+
+			for _, name := range test.Files {
+				writeTarFolders(w, path.Dir(name), folders, time.Now())
+				if err := writeTarFile(w, name, []byte(name), time.Now()); err != nil {
+					t.Fatal(err)
+				}
+			}
+			w.Close()
+
+			var entries []string
+			r := tar.NewReader(buffer)
+			for {
+				header, err := r.Next()
+				if err != nil {
+					break
+				}
+				entries = append(entries, header.Name)
+			}
+			t.Logf(`Entries: %#v`, entries)
+
+			if !slices.Equal(entries, test.Entries) {
+				t.Fail()
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFinishExport(t *testing.T) {
+	tests := []struct {
+		Index       string
+		Error       error
+		Interrupted bool
+		Aborted     error
+		Files       []string
+	}{
+		{"01", nil, false, nil, []string{"export.zip"}},
+		{"02", nil, true, nil, []string{"export.partial", "export.zip.partial"}},
+		{"03", errors.New("disk full"), false, nil, []string{"export.partial", "export.zip.partial"}},
+		{"04", nil, false, errAuthentication, []string{"export.partial", "export.zip.partial"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Index, func(t *testing.T) {
+			root := t.TempDir()
+			export := &Export{Stats: &Statistics{}, writerError: test.Error}
+			export.interrupted.Store(test.Interrupted)
+			if test.Aborted != nil {
+				export.Abort(test.Aborted)
+			}
+
+			if err := export.markPartial(root); err != nil {
+				t.Fatal(err)
+			}
+			file, err := export.createPartial(filepath.Join(root, "export.zip"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			file.Close()
+
+			err = export.Finish()
+			files, _ := filepath.Glob(filepath.Join(root, "export*"))
+			for i := range files {
+				files[i] = filepath.Base(files[i])
+			}
+			t.Logf(`Files: %v, error: %v`, files, err)
+
+			if (err != nil) != (test.Error != nil || test.Interrupted || test.Aborted != nil) || len(files) != len(test.Files) {
+				t.FailNow()
+			}
+			for i := range files {
+				if files[i] != test.Files[i] {
+					t.Fail()
+				}
+			}
+		})
+	}
+}
+
+func TestCloseArchive(t *testing.T) {
+	tests := []struct {
+		Index  string
+		Closed bool
+		Error  bool
+	}{
+		{"01", false, false},
+		{"02", true, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Index, func(t *testing.T) {
+			file, err := os.Create(filepath.Join(t.TempDir(), "export.zip.partial"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.Closed {
+				// failed flush or close is reported the same way
+				file.Close()
+			}
+
+			err = closeArchive(file, "export.zip")
+			t.Logf(`Error: %v`, err)
+
+			if (err != nil) != test.Error {
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestPrepareFileWriterFolder(t *testing.T) {
+	tests := []struct {
+		Index    string
+		Existing []string
+		Error    bool
+	}{
+		{"01", nil, false},
+		{"02", []string{}, false},
+		{"03", []string{"export.zip"}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Index, func(t *testing.T) {
+			options := RuntimeConfiguration{OutputDirectory: t.TempDir(), OutputPath: "{host}"}
+			if test.Existing != nil {
+				folder := filepath.Join(options.OutputDirectory, "po")
+				if err := os.Mkdir(folder, 0750); err != nil {
+					t.Fatal(err)
+				}
+				for _, name := range test.Existing {
+					if err := os.WriteFile(filepath.Join(folder, name), nil, 0666); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			_, err := prepareFileWriter(&options, "po")
+			t.Logf(`Output root: %s, error: %v`, options.OutputRoot, err)
+
+			if (err != nil) != test.Error {
+				t.Fail()
+			}
+		})
+	}
+}
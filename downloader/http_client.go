@@ -3,16 +3,19 @@ package main
 import (
 	"crypto/tls"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"os"
 	"strings"
 	"time"
 )
 
 var client *http.Client
 
+// errAuthentication is returned for HTTP 401 and 403, no further request can succeed
+var errAuthentication = errors.New("incorrect password")
+
 func initiateHTTPClient(options RuntimeConfiguration) {
 
 	client = &http.Client{
@@ -36,40 +39,41 @@ func initiateHTTPClient(options RuntimeConfiguration) {
 	}
 }
 
-func downloadGeneric(connect ConnectionOptions, request string) XIEnvelop {
+// downloadGeneric sends SOAP request to AdapterMessageMonitoring. Errors are returned to the
+// caller, so that downloader workers can report them per message version.
+func downloadGeneric(connect ConnectionOptions, request string) (XIEnvelop, error) {
 	req, err := http.NewRequest("POST", fmt.Sprintf("%s/AdapterMessageMonitoring/basic?style=document", connect.Hostname), strings.NewReader(request))
+	if err != nil {
+		return XIEnvelop{}, err
+	}
 	req.SetBasicAuth(connect.Username, connect.Password)
 	req.Header.Set("Content-Type", "text/xml; charset=utf-8")
 	resp, err := client.Do(req)
 	if err != nil {
-		panic(err)
+		return XIEnvelop{}, err
 	}
 	defer resp.Body.Close()
 
 	switch resp.StatusCode {
 	case 200:
 		// noop
-	case 401:
-		fmt.Printf("HTTP 401: incorrect password for user %s\n", connect.Username)
-		os.Exit(2)
-	case 403:
-		fmt.Printf("HTTP 403: incorrect password for user %s\n", connect.Username)
-		os.Exit(2)
+	case 401, 403:
+		return XIEnvelop{}, fmt.Errorf("HTTP %s: %w for user %s", resp.Status, errAuthentication, connect.Username)
 	default:
-		fmt.Printf("HTTP %s: cannot read overview for host %s\n", resp.Status, connect.Hostname)
-		os.Exit(3)
+		return XIEnvelop{}, fmt.Errorf("HTTP %s: request to host %s failed", resp.Status, connect.Hostname)
 	}
 
 	responseBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return XIEnvelop{}, err
+	}
 
 	httpResults := new(XIEnvelop)
 	err = xml.Unmarshal(responseBytes, &httpResults)
 
 	if err != nil {
-		fmt.Printf("Please verify that host [%s], username [%s] and password are correct\n", connect.Hostname, connect.Username)
-		fmt.Printf("HTTP call returned: %s\n", err.Error())
-		os.Exit(3)
+		return XIEnvelop{}, fmt.Errorf("Cannot parse response, verify that host [%s], username [%s] and password are correct: %s", connect.Hostname, connect.Username, err)
 	}
 
-	return *httpResults
+	return *httpResults, nil
 }
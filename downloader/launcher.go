@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"sync"
@@ -12,15 +13,30 @@ const (
 	ToolAuthor         = "Marat Bareev"
 )
 
-var wgDownloaders, wgUnpackers, wgWriters sync.WaitGroup
+var wgDownloaders, wgUnpackers, wgRedactors, wgWriters sync.WaitGroup
 
 func main() {
+	if stdoutRequested(os.Args[1:]) {
+		// standard output is reserved for the archive
+		os.Stdout = os.Stderr
+	}
+
 	fmt.Println(`------------------------------------------`)
 	fmt.Printf("SAP PO Tools : Downloader v%s\n", ToolVersion)
 	fmt.Printf("Public Repo  : %s\n", ToolRepo)
 	fmt.Printf("Author       : %s\n", ToolAuthor)
 	fmt.Println(`------------------------------------------`)
 
+	if len(os.Args) > 1 && os.Args[1] == CommandUnpack {
+		runUnpack(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == CommandVerify {
+		runVerify(os.Args[2:])
+		return
+	}
+
 	runtime_config, err := ParseLaunchOptions()
 	if err != nil {
 		fmt.Printf("Error parsing command-line: %s\n", err)
@@ -44,7 +60,11 @@ func main() {
 		os.Exit(3)
 	}
 
-	err = prepareFileWriter(runtime_config, connection_config)
+	var export *Export
+	source, err := sourceName(connection_config)
+	if err == nil {
+		export, err = prepareFileWriter(&runtime_config, source)
+	}
 	if err != nil {
 		fmt.Println("Error preparing output directory:", err)
 		os.Exit(4)
@@ -58,24 +78,36 @@ func main() {
 	err = searchMessages(runtime_config, connection_config, idList, messageChannel)
 	if err != nil {
 		fmt.Println("Error processing Message ID list:", err)
+		if errors.Is(err, errAuthentication) {
+			os.Exit(2)
+		}
 		os.Exit(6)
 	}
 
 	if runtime_config.StatisticsOnly {
 		statsTicker.Stop()
-		generateStatistics(messageChannel)
+		generateStatistics(runtime_config, messageChannel)
 	} else {
-		wgWriters.Add(1)
+		handleInterrupt(export)
+
 		payloadChannel := make(chan XIMessagePayloads, 100)
-		go FileWriter(runtime_config, payloadChannel)
+		writerChannel := startRedactor(runtime_config, payloadChannel)
+
+		wgWriters.Add(1)
+		go FileWriter(runtime_config, export, writerChannel)
 
 		wgUnpackers.Add(1)
 		versionChannel := make(chan XIMessageVersion, 100)
 		go Unpacker(runtime_config, versionChannel, payloadChannel)
 
+		watchQueue("versions", func() int { return len(versionChannel) }, cap(versionChannel))
+		watchQueue("payloads", func() int { return len(payloadChannel) }, cap(payloadChannel))
+		stageDownload.Workers = int32(runtime_config.DownloadThreads)
+		stageWrite.Workers = 1
+
 		for i := 0; i < runtime_config.DownloadThreads; i++ {
 			wgDownloaders.Add(1)
-			go Downloader(runtime_config, connection_config, messageChannel, versionChannel)
+			go Downloader(runtime_config, connection_config, export, messageChannel, versionChannel)
 		}
 
 		wgDownloaders.Wait()
@@ -84,11 +116,27 @@ func main() {
 		wgUnpackers.Wait()
 		close(payloadChannel)
 
+		wgRedactors.Wait()
+		if writerChannel != payloadChannel {
+			close(writerChannel)
+		}
+
 		wgWriters.Wait()
+		exitCode := 10
+		exportErr := export.Finish()
+		if exportErr == nil {
+			exitCode = 11
+			exportErr = uploadExport(runtime_config, export)
+		}
 
 		statsTicker.Stop()
-		showEndCredits()
+		showEndCredits(runtime_config)
 		openTargetDirectory(runtime_config)
+
+		if exportErr != nil {
+			fmt.Println("Error:", exportErr)
+			os.Exit(exitCode)
+		}
 	}
 
 }
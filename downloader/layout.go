@@ -0,0 +1,344 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	_ "time/tzdata" // -timezone on Windows, which has no time zone database
+)
+
+// -layout tokens
+const (
+	LayoutTokenMessageID         string = "messageId"
+	LayoutTokenEntry                    = "entry"
+	LayoutTokenMessageKey               = "messageKey"
+	LayoutTokenDirection                = "direction"
+	LayoutTokenStatus                   = "status"
+	LayoutTokenQoS                      = "qos"
+	LayoutTokenVersion                  = "version"
+	LayoutTokenVersionType              = "versionType"
+	LayoutTokenVersionName              = "versionName"
+	LayoutTokenSenderComponent          = "senderComponent"
+	LayoutTokenSenderParty              = "senderParty"
+	LayoutTokenSenderInterface          = "senderInterface"
+	LayoutTokenSenderNamespace          = "senderNamespace"
+	LayoutTokenReceiverComponent        = "receiverComponent"
+	LayoutTokenReceiverParty            = "receiverParty"
+	LayoutTokenReceiverInterface        = "receiverInterface"
+	LayoutTokenReceiverNamespace        = "receiverNamespace"
+	LayoutTokenInterface                = "interface"
+	LayoutTokenNamespace                = "namespace"
+	LayoutTokenDate                     = "date"
+	LayoutTokenYear                     = "year"
+	LayoutTokenMonth                    = "month"
+	LayoutTokenDay                      = "day"
+	LayoutTokenPayload                  = "payload"
+	LayoutTokenIndex                    = "index"
+)
+
+const (
+	LayoutDefaultDateFormat string = "yyyyMMdd"
+	LayoutEmptySegment             = "unknown"
+)
+
+var layoutTokenRegexp = regexp.MustCompile(`\{([A-Za-z]+)(?::([^{}]*))?\}`)
+
+var layoutTokens = []string{
+	LayoutTokenMessageID, LayoutTokenEntry, LayoutTokenMessageKey, LayoutTokenDirection, LayoutTokenStatus, LayoutTokenQoS,
+	LayoutTokenVersion, LayoutTokenVersionType, LayoutTokenVersionName,
+	LayoutTokenSenderComponent, LayoutTokenSenderParty, LayoutTokenSenderInterface, LayoutTokenSenderNamespace,
+	LayoutTokenReceiverComponent, LayoutTokenReceiverParty, LayoutTokenReceiverInterface, LayoutTokenReceiverNamespace,
+	LayoutTokenInterface, LayoutTokenNamespace,
+	LayoutTokenDate, LayoutTokenYear, LayoutTokenMonth, LayoutTokenDay,
+	LayoutTokenPayload, LayoutTokenIndex,
+}
+
+// processLayoutFlag validates -layout template and returns it in normalized form.
+// Template is a list of folders separated by "/", last element is a filename.
+// Payload specific tokens are allowed only in the filename. Template must identify
+// message and version, otherwise files of different messages overwrite each other.
+func processLayoutFlag(input string) (string, error) {
+	layout := strings.Trim(strings.ReplaceAll(strings.TrimSpace(input), `\`, "/"), "/")
+	if layout == "" {
+		return "", nil
+	}
+
+	used := make(map[string]bool)
+	segments := strings.Split(layout, "/")
+	for i, segment := range segments {
+		if segment == "" {
+			return "", fmt.Errorf(`Layout [%s] contains empty folder name`, input)
+		}
+
+		if strings.Count(segment, "{") != len(layoutTokenRegexp.FindAllString(segment, -1)) || strings.Count(segment, "{") != strings.Count(segment, "}") {
+			return "", fmt.Errorf(`Layout [%s] contains unbalanced braces in [%s]`, input, segment)
+		}
+
+		payloadSpecific := false
+		for _, match := range layoutTokenRegexp.FindAllStringSubmatch(segment, -1) {
+			token, param := match[1], match[2]
+
+			found := false
+			for _, known := range layoutTokens {
+				if strings.EqualFold(known, token) {
+					found = true
+					token = known
+					break
+				}
+			}
+			if !found {
+				return "", fmt.Errorf(`Layout token [%s] is unknown`, match[0])
+			}
+			used[token] = true
+
+			if param != "" && token != LayoutTokenDate {
+				return "", fmt.Errorf(`Layout token [%s] does not accept format`, match[0])
+			}
+
+			if token == LayoutTokenPayload || token == LayoutTokenIndex {
+				payloadSpecific = true
+			}
+		}
+
+		last := i == len(segments)-1
+		if payloadSpecific && !last {
+			return "", fmt.Errorf(`Layout [%s] uses {%s} or {%s} outside of filename`, input, LayoutTokenPayload, LayoutTokenIndex)
+		}
+		if !payloadSpecific && last {
+			return "", fmt.Errorf(`Layout [%s] must contain {%s} or {%s} in filename`, input, LayoutTokenPayload, LayoutTokenIndex)
+		}
+	}
+
+	message := used[LayoutTokenMessageID] || used[LayoutTokenEntry] || used[LayoutTokenMessageKey]
+	version := used[LayoutTokenVersion] || (used[LayoutTokenVersionType] && used[LayoutTokenVersionName])
+	if !message || !version {
+		return "", fmt.Errorf(`Layout [%s] must contain {%s}, {%s} or {%s} together with {%s}, otherwise files of different messages overwrite each other`,
+			input, LayoutTokenMessageID, LayoutTokenEntry, LayoutTokenMessageKey, LayoutTokenVersion)
+	}
+
+	return layout, nil
+}
+
+// expandLayout returns folder and filename for a payload given validated -layout template.
+// Index is a number of MIME part in the message (1-based), RAW content has index 0.
+// Dates are formatted in location (-timezone), nil keeps offset of the timestamp.
+// Filename is empty if it cannot be built, e.g. part has no name and layout has no {index}.
+func expandLayout(layout string, entry XIMessageVersion, payload string, index int, location *time.Location) (string, string) {
+	segments := strings.Split(layout, "/")
+
+	for i, segment := range segments {
+		expanded := layoutTokenRegexp.ReplaceAllStringFunc(segment, func(match string) string {
+			parts := layoutTokenRegexp.FindStringSubmatch(match)
+			return layoutTokenValue(parts[1], parts[2], entry, payload, index, location)
+		})
+
+		expanded = generateFilename(strings.TrimSpace(expanded))
+		last := i == len(segments)-1
+		switch {
+		case last && payload == "" && !layoutUsesToken(segment, LayoutTokenIndex):
+			// unnamed part would share the filename with other unnamed parts
+			expanded = ""
+		case expanded == "" && !last:
+			expanded = LayoutEmptySegment
+		case expanded == "." || expanded == "..":
+			expanded = strings.Repeat("_", len(expanded))
+		}
+		segments[i] = expanded
+	}
+
+	return strings.Join(segments[:len(segments)-1], "/"), segments[len(segments)-1]
+}
+
+func layoutUsesToken(segment string, token string) bool {
+	for _, match := range layoutTokenRegexp.FindAllStringSubmatch(segment, -1) {
+		if strings.EqualFold(match[1], token) {
+			return true
+		}
+	}
+	return false
+}
+
+func layoutTokenValue(token string, param string, entry XIMessageVersion, payload string, index int, location *time.Location) string {
+	msg := entry.MessageInfo
+
+	switch strings.ToLower(token) {
+	case strings.ToLower(LayoutTokenMessageID):
+		return msg.MessageID
+	case strings.ToLower(LayoutTokenEntry):
+		return entryName(msg)
+	case strings.ToLower(LayoutTokenMessageKey):
+		return msg.MessageKey
+	case strings.ToLower(LayoutTokenDirection):
+		return msg.Direction
+	case strings.ToLower(LayoutTokenStatus):
+		return msg.Status
+	case strings.ToLower(LayoutTokenQoS):
+		return msg.QualityOfService
+	case strings.ToLower(LayoutTokenVersion):
+		return fmt.Sprintf("%s.%s", entry.VersionType, entry.MessageVersion)
+	case strings.ToLower(LayoutTokenVersionType):
+		return string(entry.VersionType)
+	case strings.ToLower(LayoutTokenVersionName):
+		return entry.MessageVersion
+	case strings.ToLower(LayoutTokenSenderComponent):
+		return msg.SenderName
+	case strings.ToLower(LayoutTokenSenderParty):
+		return msg.SenderParty
+	case strings.ToLower(LayoutTokenSenderInterface):
+		return firstNonEmpty(msg.SenderInterface.Name, msg.Interface.Name)
+	case strings.ToLower(LayoutTokenSenderNamespace):
+		return firstNonEmpty(msg.SenderInterface.Namespace, msg.Interface.Namespace)
+	case strings.ToLower(LayoutTokenReceiverComponent):
+		return msg.ReceiverName
+	case strings.ToLower(LayoutTokenReceiverParty):
+		return msg.ReceiverParty
+	case strings.ToLower(LayoutTokenReceiverInterface):
+		return firstNonEmpty(msg.ReceiverInterface.Name, msg.Interface.Name)
+	case strings.ToLower(LayoutTokenReceiverNamespace):
+		return firstNonEmpty(msg.ReceiverInterface.Namespace, msg.Interface.Namespace)
+	case strings.ToLower(LayoutTokenInterface):
+		return msg.Interface.Name
+	case strings.ToLower(LayoutTokenNamespace):
+		return msg.Interface.Namespace
+	case strings.ToLower(LayoutTokenDate):
+		if param == "" {
+			param = LayoutDefaultDateFormat
+		}
+		return formatMessageTime(msg, param, location)
+	case strings.ToLower(LayoutTokenYear):
+		return formatMessageTime(msg, "yyyy", location)
+	case strings.ToLower(LayoutTokenMonth):
+		return formatMessageTime(msg, "MM", location)
+	case strings.ToLower(LayoutTokenDay):
+		return formatMessageTime(msg, "dd", location)
+	case strings.ToLower(LayoutTokenPayload):
+		return payload
+	case strings.ToLower(LayoutTokenIndex):
+		return fmt.Sprintf("%d", index)
+	default:
+		return ""
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func formatMessageTime(msg XIAdapterMessage, format string, location *time.Location) string {
+	t := messageTime(msg, location)
+	if t.IsZero() {
+		return ""
+	}
+	return formatJavaDate(t, format)
+}
+
+// messageTime returns start time of the message in location (-timezone), nil location
+// keeps offset of the timestamp. Zero time is returned if timestamp is unknown.
+func messageTime(msg XIAdapterMessage, location *time.Location) time.Time {
+	t := parseMessageTime(msg.StartTime, location)
+	if t.IsZero() || location == nil {
+		return t
+	}
+	return t.In(location)
+}
+
+// parseMessageTime accepts timestamps as returned by AdapterMessageMonitoring service.
+// Timestamps without offset are in location, UTC if location is nil.
+// Zero time is returned if timestamp is missing or not recognized.
+func parseMessageTime(value string, location *time.Location) time.Time {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}
+	}
+
+	if location == nil {
+		location = time.UTC
+	}
+
+	layouts := []string{
+		time.RFC3339Nano,
+		"2006-01-02T15:04:05.999999999Z0700",
+		"2006-01-02T15:04:05.999999999",
+		"2006-01-02 15:04:05.999999999",
+	}
+
+	for _, layout := range layouts {
+		t, err := time.ParseInLocation(layout, value, location)
+		if err == nil {
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+// processTimeZoneFlag returns location of -timezone: IANA name (Europe/Berlin), UTC or
+// Local. Nil is returned if not specified.
+func processTimeZoneFlag(input string) (*time.Location, error) {
+	input = strings.TrimSpace(input)
+	switch strings.ToLower(input) {
+	case "":
+		return nil, nil
+	case "local":
+		return time.Local, nil
+	case "utc":
+		return time.UTC, nil
+	}
+
+	location, err := time.LoadLocation(input)
+	if err != nil {
+		return nil, fmt.Errorf("Time zone [%s] is unknown. Use name like Europe/Berlin, UTC or Local", input)
+	}
+	return location, nil
+}
+
+// formatJavaDate formats time using Java-style (SimpleDateFormat) patterns familiar to SAP PO users:
+// yyyy, yy, MM, MMM, dd, HH, mm, ss, SSS. Any other character is copied as-is.
+func formatJavaDate(t time.Time, format string) string {
+	var result strings.Builder
+
+	for i := 0; i < len(format); {
+		j := i
+		for j < len(format) && format[j] == format[i] {
+			j++
+		}
+		run := j - i
+
+		switch format[i] {
+		case 'y':
+			if run == 2 {
+				fmt.Fprintf(&result, "%02d", t.Year()%100)
+			} else {
+				fmt.Fprintf(&result, "%04d", t.Year())
+			}
+		case 'M':
+			if run >= 3 {
+				result.WriteString(t.Month().String()[:3])
+			} else {
+				fmt.Fprintf(&result, "%0*d", run, int(t.Month()))
+			}
+		case 'd':
+			fmt.Fprintf(&result, "%0*d", run, t.Day())
+		case 'H':
+			fmt.Fprintf(&result, "%0*d", run, t.Hour())
+		case 'm':
+			fmt.Fprintf(&result, "%0*d", run, t.Minute())
+		case 's':
+			fmt.Fprintf(&result, "%0*d", run, t.Second())
+		case 'S':
+			fmt.Fprintf(&result, "%03d", t.Nanosecond()/int(time.Millisecond))
+		default:
+			result.WriteString(format[i:j])
+		}
+
+		i = j
+	}
+
+	return result.String()
+}
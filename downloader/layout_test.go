@@ -0,0 +1,193 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLayoutFlag(t *testing.T) {
+	tests := []struct {
+		Index    string
+		Input    string
+		Expected string
+		Error    bool
+	}{
+		{"01", "", "", false},
+		{"02", "{payload}", "", true},
+		{"03", " /{messageId}/{version}/{payload}/ ", "{messageId}/{version}/{payload}", false},
+		{"04", `{receiverInterface}\{date:yyyy-MM-dd}\{messageId}\{version}\{payload}`, "{receiverInterface}/{date:yyyy-MM-dd}/{messageId}/{version}/{payload}", false},
+		{"05", "{MESSAGEID}.{index}", "", true},
+		{"06", "{messageId}/{version}", "", true},
+		{"07", "{payload}/{messageId}", "", true},
+		{"08", "{messageId}//{payload}", "", true},
+		{"09", "{sender}/{payload}", "", true},
+		{"10", "{messageId/{payload}", "", true},
+		{"11", "{messageId:yyyy}/{payload}", "", true},
+		{"12", "{date:yyyy}}/{payload}", "", true},
+		{"13", "{MESSAGEID}.{VersionType}.{versionname}.{index}", "{MESSAGEID}.{VersionType}.{versionname}.{index}", false},
+		{"14", "{receiverInterface}/{payload}", "", true},
+		{"15", "{messageKey}/{versionName}/{payload}", "", true},
+		{"16", "{entry}/{version}/{payload}", "{entry}/{version}/{payload}", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Index, func(t *testing.T) {
+			layout, err := processLayoutFlag(test.Input)
+			t.Logf(`Expected : %#v`, test.Expected)
+			t.Logf(`Parsed as: %#v`, layout)
+			if err != nil {
+				t.Logf(`Error msg: %s`, err)
+			}
+
+			if layout != test.Expected || (err != nil) != test.Error {
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestLayoutExpansion(t *testing.T) {
+	entry := XIMessageVersion{
+		MessageInfo: XIAdapterMessage{
+			MessageID:         "e1f49308-b5d9-1ede-a1e6-a84cac19a8d2",
+			MessageKey:        "e1f49308-b5d9-1ede-a1e6-a84cac19a8d2\\OUTBOUND\\0\\EO\\0\\",
+			Direction:         "OUTBOUND",
+			SenderName:        "BC_SENDER",
+			ReceiverName:      "BC_RECEIVER",
+			StartTime:         "2023-11-21T09:05:07.123+03:00",
+			Interface:         XIInterface{Name: "SI_Order_Out", Namespace: "urn:example.com:orders"},
+			ReceiverInterface: XIInterface{Name: "SI_Order_In", Namespace: "urn:example.com:orders"},
+		},
+		VersionType:    VersionTypeLogged,
+		MessageVersion: "MS",
+	}
+
+	tests := []struct {
+		Index    string
+		Layout   string
+		Payload  string
+		Folder   string
+		Filename string
+	}{
+		{"01", "{messageId}.{version}.{payload}", "MainDocument", "", "ID.LOG.MS.MainDocument"},
+		{"02", "{receiverInterface}/{date:yyyy-MM-dd}/{messageId}/{version}/{payload}", "MainDocument", "SI_Order_In/2023-11-21/ID/LOG.MS", "MainDocument"},
+		{"03", "{senderInterface}/{senderParty}/{messageId}.{version}.{index}_{payload}", "MainDocument", "SI_Order_Out/unknown", "ID.LOG.MS.2_MainDocument"},
+		{"04", "{namespace}/{date:yyMMdd_HHmmss.SSS}/{messageId}/{versionType}-{versionName}.{payload}", "MainDocument", "urn_example.com_orders/231121_090507.123/ID", "LOG-MS.MainDocument"},
+		{"05", "{messageKey}/{version}/{payload}", "MainDocument", "ID_OUTBOUND_0_EO_0_/LOG.MS", "MainDocument"},
+		{"06", "{year}/{month}/{day}/{direction}/{messageId}/{version}/{payload}", "MainDocument", "2023/11/21/OUTBOUND/ID/LOG.MS", "MainDocument"},
+		{"07", "{messageId}/{version}/{payload}", "", "ID/LOG.MS", ""},
+		{"08", "{messageId}/{version}/{index}_{payload}", "", "ID/LOG.MS", "2_"},
+		{"09", "{messageId}/{version}/{senderParty}{payload}", "", "ID/LOG.MS", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Index, func(t *testing.T) {
+			layout, err := processLayoutFlag(test.Layout)
+			if err != nil {
+				t.Fatalf(`Error msg: %s`, err)
+			}
+
+			folder, filename := expandLayout(layout, entry, test.Payload, 2, nil)
+			folder = strings.ReplaceAll(folder, entry.MessageInfo.MessageID, "ID")
+			filename = strings.ReplaceAll(filename, entry.MessageInfo.MessageID, "ID")
+			t.Logf(`Expected : %s | %s`, test.Folder, test.Filename)
+			t.Logf(`Expanded : %s | %s`, folder, filename)
+
+			if folder != test.Folder || filename != test.Filename {
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestJavaDateFormat(t *testing.T) {
+	moment := time.Date(2023, time.March, 4, 5, 6, 7, 890000000, time.UTC)
+
+	tests := []struct {
+		Format   string
+		Expected string
+	}{
+		{"yyyy-MM-dd", "2023-03-04"},
+		{"yyMMdd", "230304"},
+		{"HH:mm:ss.SSS", "05:06:07.890"},
+		{"dd MMM yyyy", "04 Mar 2023"},
+		{"yyyyMMdd'T'HH", "20230304'T'05"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Format, func(t *testing.T) {
+			formatted := formatJavaDate(moment, test.Format)
+			if formatted != test.Expected {
+				t.Errorf(`Expected %s, got %s`, test.Expected, formatted)
+			}
+		})
+	}
+}
+
+func TestMessageTime(t *testing.T) {
+	berlin, err := processTimeZoneFlag("Europe/Berlin")
+	if err != nil {
+		t.Fatalf(`Error msg: %s`, err)
+	}
+
+	tests := []struct {
+		Index     string
+		StartTime string
+		Location  *time.Location
+		Expected  string
+	}{
+		{"01", "2023-11-21T09:05:07.123+03:00", nil, "2023-11-21 09:05:07.123 +03:00"},
+		{"02", "2023-11-21T09:05:07.123+03:00", berlin, "2023-11-21 07:05:07.123 +01:00"},
+		{"03", "2023-11-21T09:05:07.123+03:00", time.UTC, "2023-11-21 06:05:07.123 +00:00"},
+		{"04", "2023-07-01 12:00:00", nil, "2023-07-01 12:00:00.000 +00:00"},
+		{"05", "2023-07-01 12:00:00", berlin, "2023-07-01 12:00:00.000 +02:00"},
+		{"06", "", berlin, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Index, func(t *testing.T) {
+			moment := messageTime(XIAdapterMessage{StartTime: test.StartTime}, test.Location)
+			result := ""
+			if !moment.IsZero() {
+				result = moment.Format("2006-01-02 15:04:05.000 -07:00")
+			}
+			t.Logf(`Expected : %s`, test.Expected)
+			t.Logf(`Result   : %s`, result)
+
+			if result != test.Expected {
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestTimeZoneFlag(t *testing.T) {
+	tests := []struct {
+		Index    string
+		Input    string
+		Expected string
+		Error    bool
+	}{
+		{"01", "", "", false},
+		{"02", "utc", "UTC", false},
+		{"03", "Local", "Local", false},
+		{"04", "Asia/Tokyo", "Asia/Tokyo", false},
+		{"05", "Mars/Olympus", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Index, func(t *testing.T) {
+			location, err := processTimeZoneFlag(test.Input)
+			result := ""
+			if location != nil {
+				result = location.String()
+			}
+			t.Logf(`Location: %s, error: %v`, result, err)
+
+			if result != test.Expected || (err != nil) != test.Error {
+				t.Fail()
+			}
+		})
+	}
+}
@@ -64,6 +64,8 @@ func searchMessages(options RuntimeConfiguration, connect ConnectionOptions, idL
 	// stats
 	statistics.MessagesFound = int32(len(response.Response.List.AdapterFrameworkData))
 
+	assignEntryNames(response.Response.List.AdapterFrameworkData)
+
 	go func(response XIgetMessageListResponse, msgChannel chan<- XIAdapterMessage) {
 		for _, msg := range response.Response.List.AdapterFrameworkData {
 			msgChannel <- msg
@@ -75,6 +77,53 @@ func searchMessages(options RuntimeConfiguration, connect ConnectionOptions, idL
 	return nil
 }
 
+// assignEntryNames gives every message entry a name unique within export.
+// Same message ID is often returned several times (inbound and outbound
+// entries, one entry per receiver), such entries get direction and receiver
+// added to message ID. Remaining collisions are resolved with numeric suffix.
+func assignEntryNames(list []XIAdapterMessage) {
+	count := make(map[string]int)
+	for _, msg := range list {
+		count[msg.MessageID] += 1
+	}
+
+	// process entries in stable order so names do not depend on server response order
+	order := make([]int, len(list))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return list[order[a]].MessageKey < list[order[b]].MessageKey
+	})
+
+	used := make(map[string]bool)
+	for _, i := range order {
+		msg := &list[i]
+
+		name := msg.MessageID
+		if count[msg.MessageID] > 1 {
+			name = strings.Join([]string{msg.MessageID, msg.Direction, firstNonEmpty(msg.ReceiverName, msg.ReceiverInterface.Name, msg.Interface.Name)}, ".")
+			name = strings.TrimRight(name, ".")
+		}
+
+		candidate := name
+		for postfix := 2; used[strings.ToLower(candidate)]; postfix++ {
+			candidate = fmt.Sprintf("%s_%d", name, postfix)
+		}
+
+		used[strings.ToLower(candidate)] = true
+		msg.EntryName = candidate
+	}
+}
+
+// entryName returns name of the message entry used in output paths
+func entryName(msg XIAdapterMessage) string {
+	if msg.EntryName != "" {
+		return msg.EntryName
+	}
+	return msg.MessageID
+}
+
 func search(connect ConnectionOptions, IDList []string) (XIgetMessageListResponse, error) {
 
 	IDListFormatted := ""
@@ -106,7 +155,10 @@ func search(connect ConnectionOptions, IDList []string) (XIgetMessageListRespons
 	// maxMessages is set to sensible default
 	// TODO: add processing for continueation
 
-	httpResults := downloadGeneric(connect, requestTemplate)
+	httpResults, err := downloadGeneric(connect, requestTemplate)
+	if err != nil {
+		return XIgetMessageListResponse{}, err
+	}
 
 	if len(httpResults.Body.GetMessageListResponse.Response.List.AdapterFrameworkData) == 0 {
 		return XIgetMessageListResponse{}, errors.New("no messages found in target system")
@@ -45,3 +45,25 @@ func getMessageListTester(filename string, expected int) func(t *testing.T) {
 	}
 
 }
+
+func TestEntryNames(t *testing.T) {
+	list := []XIAdapterMessage{
+		{MessageID: "aaa", MessageKey: "aaa\\OUTBOUND\\2", Direction: "OUTBOUND", ReceiverName: "BC_TWO"},
+		{MessageID: "aaa", MessageKey: "aaa\\INBOUND\\0", Direction: "INBOUND", ReceiverName: "BC_ONE"},
+		{MessageID: "aaa", MessageKey: "aaa\\OUTBOUND\\1", Direction: "OUTBOUND", ReceiverName: "BC_ONE"},
+		{MessageID: "bbb", MessageKey: "bbb\\OUTBOUND\\0", Direction: "OUTBOUND", ReceiverName: "BC_ONE"},
+		{MessageID: "ccc", MessageKey: "ccc\\OUTBOUND\\0", Direction: "OUTBOUND"},
+		{MessageID: "ccc", MessageKey: "ccc\\OUTBOUND\\1", Direction: "OUTBOUND"},
+	}
+
+	expected := []string{"aaa.OUTBOUND.BC_TWO", "aaa.INBOUND.BC_ONE", "aaa.OUTBOUND.BC_ONE", "bbb", "ccc.OUTBOUND", "ccc.OUTBOUND_2"}
+
+	assignEntryNames(list)
+
+	for i, msg := range list {
+		t.Logf(`Entry %s: expected %s, got %s`, msg.MessageKey, expected[i], msg.EntryName)
+		if msg.EntryName != expected[i] {
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"mime/multipart"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	CommandUnpack     string = "unpack"
+	OfflineSourceName        = "offline"
+)
+
+var (
+	messageGUIDRegexp    = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+	offlineVersionRegexp = regexp.MustCompile(`(?:^|[/._])(LOG|STAGE)\.([A-Za-z0-9_-]+)(?:[/._]|$)`)
+)
+
+// runUnpack processes raw XI messages from local files (e.g. RAW files of earlier
+// exports or messages saved from NWA) the same way as downloaded ones
+func runUnpack(args []string) {
+	runtime_config, inputs, err := ParseUnpackOptions(args)
+	if err != nil {
+		fmt.Printf("Error parsing command-line: %s\n", err)
+		os.Exit(1)
+	}
+
+	export, err := prepareFileWriter(&runtime_config, OfflineSourceName)
+	if err != nil {
+		fmt.Println("Error preparing output directory:", err)
+		os.Exit(4)
+	}
+
+	statsTicker := runStatistics()
+	handleInterrupt(export)
+
+	payloadChannel := make(chan XIMessagePayloads, 100)
+	writerChannel := startRedactor(runtime_config, payloadChannel)
+
+	wgWriters.Add(1)
+	go FileWriter(runtime_config, export, writerChannel)
+
+	wgUnpackers.Add(1)
+	versionChannel := make(chan XIMessageVersion, 100)
+	go Unpacker(runtime_config, versionChannel, payloadChannel)
+
+	watchQueue("versions", func() int { return len(versionChannel) }, cap(versionChannel))
+	watchQueue("payloads", func() int { return len(payloadChannel) }, cap(payloadChannel))
+	stageWrite.Workers = 1
+
+	skipped := 0
+	for _, input := range inputs {
+		if export.Interrupted() {
+			break
+		}
+		skipped += readOfflineInput(export, input, versionChannel)
+	}
+	close(versionChannel)
+
+	wgUnpackers.Wait()
+	close(payloadChannel)
+
+	wgRedactors.Wait()
+	if writerChannel != payloadChannel {
+		close(writerChannel)
+	}
+
+	wgWriters.Wait()
+	exitCode := 10
+	exportErr := export.Finish()
+	if exportErr == nil {
+		exitCode = 11
+		exportErr = uploadExport(runtime_config, export)
+	}
+
+	statsTicker.Stop()
+	if skipped > 0 {
+		fmt.Printf("Skipped %d files which are not XI multipart messages\n", skipped)
+	}
+	showEndCredits(runtime_config)
+	openTargetDirectory(runtime_config)
+
+	if exportErr != nil {
+		fmt.Println("Error:", exportErr)
+		os.Exit(exitCode)
+	}
+}
+
+// readOfflineInput reads file, folder (recursively) or ZIP archive and sends every XI message
+// found to the unpacker. Returns number of skipped files.
+func readOfflineInput(export *Export, input string, versionChan chan<- XIMessageVersion) int {
+	info, err := os.Stat(input)
+	if err != nil {
+		fmt.Printf("Cannot read [%s]: %s\n", input, err)
+		return 0
+	}
+
+	if !info.IsDir() {
+		data, err := os.ReadFile(input)
+		if err != nil {
+			fmt.Printf("Cannot read [%s]: %s\n", input, err)
+			return 0
+		}
+
+		skipped := readOfflineFile(export, filepath.ToSlash(input), data, versionChan, true)
+		if skipped > 0 && !bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+			fmt.Printf("Skipping [%s]: not an XI multipart message\n", input)
+		}
+		return skipped
+	}
+
+	skipped := 0
+	err = filepath.WalkDir(input, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			fmt.Printf("Cannot read [%s]: %s\n", name, err)
+			return nil
+		}
+		if export.Interrupted() {
+			return filepath.SkipAll
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		data, err := os.ReadFile(name)
+		if err != nil {
+			fmt.Printf("Cannot read [%s]: %s\n", name, err)
+			return nil
+		}
+
+		skipped += readOfflineFile(export, filepath.ToSlash(name), data, versionChan, true)
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("Cannot read [%s]: %s\n", input, err)
+	}
+
+	return skipped
+}
+
+// readOfflineFile handles single file. Top-level ZIP archives are read entry by entry,
+// GZIP files (-zip file exports) are decompressed.
+func readOfflineFile(export *Export, name string, data []byte, versionChan chan<- XIMessageVersion, topLevel bool) int {
+	switch {
+	case topLevel && bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			fmt.Printf("Cannot read ZIP archive [%s]: %s\n", name, err)
+			return 1
+		}
+
+		skipped := 0
+		for _, file := range reader.File {
+			if export.Interrupted() {
+				break
+			}
+			if file.FileInfo().IsDir() {
+				continue
+			}
+
+			rc, err := file.Open()
+			if err != nil {
+				fmt.Printf("Cannot read [%s] in ZIP archive [%s]: %s\n", file.Name, name, err)
+				continue
+			}
+			contents, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				fmt.Printf("Cannot read [%s] in ZIP archive [%s]: %s\n", file.Name, name, err)
+				continue
+			}
+
+			skipped += readOfflineFile(export, name+"/"+file.Name, contents, versionChan, false)
+		}
+		return skipped
+
+	case bytes.HasPrefix(data, []byte("\x1f\x8b")):
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return 1
+		}
+		contents, err := io.ReadAll(reader)
+		if err != nil {
+			return 1
+		}
+		return readOfflineFile(export, strings.TrimSuffix(name, ".gz"), contents, versionChan, false)
+	}
+
+	header, ok := peekXIHeader(data)
+	if !ok {
+		return 1
+	}
+
+	versionChan <- offlineMessageVersion(name, header, data)
+
+	atomic.AddInt32(&statistics.MessagesFound, 1)
+	atomic.AddInt32(&statistics.MessagesDownloaded, 1)
+	atomic.AddInt64(&statistics.NetworkBytesDownloaded, int64(len(data)))
+	return 0
+}
+
+// peekXIHeader checks that data is XI multipart message and parses its XI header.
+// Header is nil if message has no readable XI header.
+func peekXIHeader(data []byte) (*XIHeader, bool) {
+	headers, body, _ := parseMessageHeaders(data)
+
+	mediatype, params, _ := mime.ParseMediaType(headers.Get("Content-Type"))
+	if !strings.HasPrefix(mediatype, MultipartRelated) || params["boundary"] == "" {
+		return nil, false
+	}
+
+	body, _ = normalizeMultipartHeaders(body, params["boundary"])
+	mr := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+
+	for partIndex := 1; ; partIndex++ {
+		p, err := mr.NextRawPart()
+		if err != nil {
+			return nil, true
+		}
+
+		if p.Header.Get("Content-Id") != params["start"] && (params["start"] != "" || partIndex > 1) {
+			continue
+		}
+
+		partData, err := io.ReadAll(p)
+		if err != nil {
+			return nil, true
+		}
+		partData, _, _ = decodeTransferEncoding(p.Header.Get("Content-Transfer-Encoding"), partData)
+
+		header, err := processXIHeader(partData)
+		if err != nil {
+			return nil, true
+		}
+		return &header, true
+	}
+}
+
+// offlineMessageVersion fills message attributes from XI header. Message ID and version
+// are taken from file path if missing, e.g. export/LOG.MS/6b1c3e2e-8a11-11ee-b8d6-00000c9d89ea.RAW
+func offlineMessageVersion(name string, header *XIHeader, data []byte) XIMessageVersion {
+	msg := XIAdapterMessage{}
+
+	if header != nil {
+		main := header.Main
+		msg.MessageID = main.MessageID
+		msg.StartTime = main.TimeSent
+		msg.SenderName = main.Sender.Service
+		msg.SenderParty = main.Sender.Party.Value
+		msg.ReceiverName = main.Receiver.Service
+		msg.ReceiverParty = main.Receiver.Party.Value
+		msg.Interface = XIInterface{Name: main.Interface.Name, Namespace: main.Interface.Namespace}
+		msg.QualityOfService = header.ReliableMessaging["QualityOfService"]
+	}
+
+	base := path.Base(name)
+	base = strings.TrimSuffix(base, path.Ext(base))
+
+	if msg.MessageID == "" {
+		msg.MessageID = firstNonEmpty(messageGUIDRegexp.FindString(name), generateFilename(base))
+	}
+	msg.MessageKey = msg.MessageID
+
+	version := XIMessageVersion{
+		MessageInfo:    msg,
+		VersionType:    VersionTypeOffline,
+		MessageVersion: generateFilename(base),
+		RawContents:    data,
+	}
+
+	// closest to the file name wins
+	if matches := offlineVersionRegexp.FindAllStringSubmatch(name, -1); matches != nil {
+		match := matches[len(matches)-1]
+		version.VersionType = VersionType(match[1])
+		version.MessageVersion = match[2]
+	}
+
+	return version
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestOfflineMessageVersion(t *testing.T) {
+	tests := []struct {
+		Index     string
+		Name      string
+		Header    *XIHeader
+		MessageID string
+		Version   string
+	}{
+		{"01", "export/LOG.MS/6b1c3e2e-8a11-11ee-b8d6-00000c9d89ea.RAW", nil, "6b1c3e2e-8a11-11ee-b8d6-00000c9d89ea", "LOG.MS"},
+		{"02", "export/6b1c3e2e-8a11-11ee-b8d6-00000c9d89ea/STAGE.2.RAW", nil, "6b1c3e2e-8a11-11ee-b8d6-00000c9d89ea", "STAGE.2"},
+		{"03", "x/LOG.old/6b1c3e2e-8a11-11ee-b8d6-00000c9d89ea.LOG.AM.RAW", nil, "6b1c3e2e-8a11-11ee-b8d6-00000c9d89ea", "LOG.AM"},
+		{"04", "nwa/order message.txt", nil, "order message", "FILE.order message"},
+		{"05", "nwa/msg.txt", &XIHeader{Main: XIHeaderMain{MessageID: "11111111-2222-3333-4444-555555555555"}}, "11111111-2222-3333-4444-555555555555", "FILE.msg"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Index, func(t *testing.T) {
+			version := offlineMessageVersion(test.Name, test.Header, []byte{})
+			versionID := string(version.VersionType) + "." + version.MessageVersion
+			t.Logf(`Message ID: %s, version: %s`, version.MessageInfo.MessageID, versionID)
+
+			if version.MessageInfo.MessageID != test.MessageID || versionID != test.Version {
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestReadOfflineInput(t *testing.T) {
+	folder := filepath.Join("testdata", "messages")
+
+	// same messages packed into ZIP archive, as GZIP files of -zip file export
+	samples, _ := filepath.Glob(filepath.Join(folder, "*.testdata"))
+	buffer := new(bytes.Buffer)
+	w := zip.NewWriter(buffer)
+	for _, sample := range samples {
+		data, err := os.ReadFile(sample)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, _ := w.Create("LOG.BI/" + filepath.Base(sample))
+		f.Write(data)
+	}
+	w.Close()
+
+	archive := filepath.Join(t.TempDir(), "raw.zip")
+	if err := os.WriteFile(archive, buffer.Bytes(), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		Input    string
+		Messages int
+		Skipped  int
+	}{
+		{folder, 5, 1},
+		{filepath.Join(folder, "03.attachments.testdata"), 1, 0},
+		{archive, 5, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(filepath.Base(test.Input), func(t *testing.T) {
+			versions := make(chan XIMessageVersion, 100)
+			skipped := readOfflineInput(&Export{}, test.Input, versions)
+			close(versions)
+
+			ids := []string{}
+			for version := range versions {
+				ids = append(ids, version.MessageInfo.MessageID)
+				if test.Input == archive && version.VersionType+"."+VersionType(version.MessageVersion) != "LOG.BI" {
+					t.Errorf(`Unexpected version %s.%s`, version.VersionType, version.MessageVersion)
+				}
+			}
+			t.Logf(`Messages: %#v, skipped: %d`, ids, skipped)
+
+			if len(ids) != test.Messages || skipped != test.Skipped || slices.Contains(ids, "") {
+				t.Fail()
+			}
+		})
+	}
+}
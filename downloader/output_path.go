@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// -outputpath tokens
+const (
+	OutputTokenHost      string = "host"
+	OutputTokenSID              = "sid"
+	OutputTokenTimestamp        = "timestamp"
+	OutputTokenIDFile           = "idfile"
+)
+
+const (
+	OutputPathDefault         string = "{host}/{timestamp}"
+	OutputTimestampFormat            = "yyyyMMddHHmmss"
+	OutputIDFileDefaultName          = "export"
+	outputPathMaxSegmentCount        = 16
+)
+
+// outputPathValues are values of -outputpath tokens known when export starts
+type outputPathValues struct {
+	Host    string
+	SID     string // -sid, host is used if not set
+	Started time.Time
+	IDFile  string // name of -ids file without extension
+}
+
+// processOutputPathFlag validates -outputpath template and returns it in normalized form
+func processOutputPathFlag(input string) (string, error) {
+	template := strings.Trim(strings.ReplaceAll(strings.TrimSpace(input), `\`, "/"), "/")
+	if template == "" {
+		return OutputPathDefault, nil
+	}
+
+	segments := strings.Split(template, "/")
+	if len(segments) > outputPathMaxSegmentCount {
+		return "", fmt.Errorf(`Output path [%s] has too many folders`, input)
+	}
+
+	for _, segment := range segments {
+		if segment == "" || segment == "." || segment == ".." {
+			return "", fmt.Errorf(`Output path [%s] contains empty or relative folder name`, input)
+		}
+		if strings.Count(segment, "{") != len(layoutTokenRegexp.FindAllString(segment, -1)) || strings.Count(segment, "{") != strings.Count(segment, "}") {
+			return "", fmt.Errorf(`Output path [%s] contains unbalanced braces in [%s]`, input, segment)
+		}
+
+		for _, match := range layoutTokenRegexp.FindAllStringSubmatch(segment, -1) {
+			switch match[1] {
+			case OutputTokenHost, OutputTokenSID, OutputTokenIDFile:
+				if match[2] != "" {
+					return "", fmt.Errorf(`Output path token {%s} does not support format`, match[1])
+				}
+			case OutputTokenTimestamp:
+			default:
+				return "", fmt.Errorf(`Output path token {%s} is unknown. Available tokens: {%s}, {%s}, {%s}, {%s}`, match[1], OutputTokenHost, OutputTokenSID, OutputTokenTimestamp, OutputTokenIDFile)
+			}
+		}
+	}
+
+	return template, nil
+}
+
+// expandOutputPath returns folder of the export relative to -output, with "/" separators
+func expandOutputPath(template string, values outputPathValues) string {
+	segments := strings.Split(template, "/")
+	for i, segment := range segments {
+		segment = layoutTokenRegexp.ReplaceAllStringFunc(segment, func(token string) string {
+			match := layoutTokenRegexp.FindStringSubmatch(token)
+			switch match[1] {
+			case OutputTokenHost:
+				return values.Host
+			case OutputTokenSID:
+				return firstNonEmpty(values.SID, values.Host)
+			case OutputTokenTimestamp:
+				return formatJavaDate(values.Started, firstNonEmpty(match[2], OutputTimestampFormat))
+			case OutputTokenIDFile:
+				return firstNonEmpty(strings.TrimSuffix(values.IDFile, path.Ext(values.IDFile)), OutputIDFileDefaultName)
+			}
+			return token
+		})
+
+		segments[i] = generateFilename(firstNonEmpty(segment, LayoutEmptySegment))
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProcessOutputPathFlag(t *testing.T) {
+	tests := []struct {
+		Index  string
+		Input  string
+		Result string
+		Error  bool
+	}{
+		{"01", "", OutputPathDefault, false},
+		{"02", `\{sid}\{timestamp:yyyy-MM-dd}\`, "{sid}/{timestamp:yyyy-MM-dd}", false},
+		{"03", "{host}/{idfile}_{timestamp}", "{host}/{idfile}_{timestamp}", false},
+		{"04", "{host}/../{timestamp}", "", true},
+		{"05", "{host}//{timestamp}", "", true},
+		{"06", "{messageId}", "", true},
+		{"07", "{host:upper}", "", true},
+		{"08", "{host/{timestamp}", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Index, func(t *testing.T) {
+			result, err := processOutputPathFlag(test.Input)
+			t.Logf(`Result: %s, error: %v`, result, err)
+
+			if result != test.Result || (err != nil) != test.Error {
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestExpandOutputPath(t *testing.T) {
+	values := outputPathValues{
+		Host:    "po.example.com",
+		Started: time.Date(2023, 12, 17, 9, 5, 1, 0, time.UTC),
+		IDFile:  "incident.txt",
+	}
+
+	tests := []struct {
+		Index    string
+		Template string
+		SID      string
+		Result   string
+	}{
+		{"01", OutputPathDefault, "", "po.example.com/20231217090501"},
+		{"02", "{sid}/{timestamp:yyyy-MM-dd}/{idfile}", "PO1", "PO1/2023-12-17/incident"},
+		{"03", "{sid}/{idfile}", "", "po.example.com/incident"},
+		{"04", "{sid}", "A:B", "A_B"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Index, func(t *testing.T) {
+			values.SID = test.SID
+			result := expandOutputPath(test.Template, values)
+			t.Logf(`Result: %s`, result)
+
+			if result != test.Result {
+				t.Fail()
+			}
+		})
+	}
+}
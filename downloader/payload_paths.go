@@ -0,0 +1,432 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// PayloadPath is a simple path expression to locate values in XML or JSON payloads.
+//
+// XPath subset: /a/b (child), //b (descendant), * (any element), namespace prefixes
+// are ignored, relative path b/c is the same as //b/c.
+//
+// JSONPath subset: $ (root), .key, ['key'], .* and [*] (any), [n] (array index),
+// ..key (descendant).
+type PayloadPath struct {
+	Expression string
+	xmlSteps   []xmlPathStep
+	jsonSteps  []jsonPathStep
+}
+
+// PathMatch is a value found by PayloadPath. Start and End are byte offsets of the value
+// in the document: contents of the element for XML, whole JSON value (including quotes).
+// ElementStart and ElementEnd include start and end tags of XML element.
+type PathMatch struct {
+	Path         string // location of the value, e.g. /Invoice/Attachment/Data or $.files[0].content
+	Name         string // last element name or object key
+	Value        string // text of the element or value of JSON string
+	Start        int64
+	End          int64
+	ElementStart int64
+	ElementEnd   int64
+}
+
+type xmlPathStep struct {
+	name       string
+	descendant bool
+}
+
+type jsonPathStep struct {
+	key        string
+	index      int
+	isIndex    bool
+	any        bool
+	descendant bool
+}
+
+type jsonPathComponent struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+func parsePayloadPath(expression string) (PayloadPath, error) {
+	expression = strings.TrimSpace(expression)
+	result := PayloadPath{Expression: expression}
+
+	var err error
+	if strings.HasPrefix(expression, "$") {
+		result.jsonSteps, err = parseJSONPath(expression)
+	} else {
+		result.xmlSteps, err = parseXMLPath(expression)
+	}
+	if err != nil {
+		return PayloadPath{}, fmt.Errorf("Path [%s] is incorrect: %s", expression, err)
+	}
+	return result, nil
+}
+
+func (p PayloadPath) IsJSON() bool {
+	return p.jsonSteps != nil
+}
+
+func (p PayloadPath) String() string {
+	return p.Expression
+}
+
+// Find returns all values matching the path in document order. Matches of nested
+// elements are returned after the outer one.
+func (p PayloadPath) Find(data []byte) ([]PathMatch, error) {
+	if p.IsJSON() {
+		return findJSONPath(data, p.jsonSteps)
+	}
+	return findXMLPath(data, p.xmlSteps)
+}
+
+func parseXMLPath(expression string) ([]xmlPathStep, error) {
+	if expression == "" {
+		return nil, errors.New("empty path")
+	}
+
+	// relative path can be anywhere in the document
+	if !strings.HasPrefix(expression, "/") {
+		expression = "//" + expression
+	}
+	// text() is implied
+	expression = strings.TrimSuffix(expression, "/text()")
+
+	steps := []xmlPathStep{}
+	descendant := false
+	for _, segment := range strings.Split(expression[1:], "/") {
+		if segment == "" {
+			if descendant {
+				return nil, errors.New("unexpected ///")
+			}
+			descendant = true
+			continue
+		}
+		if strings.ContainsAny(segment, "[]()@=") {
+			return nil, fmt.Errorf("unsupported step [%s]", segment)
+		}
+
+		// prefixes are not resolved
+		if i := strings.LastIndex(segment, ":"); i >= 0 {
+			segment = segment[i+1:]
+		}
+		steps = append(steps, xmlPathStep{name: segment, descendant: descendant})
+		descendant = false
+	}
+
+	if len(steps) == 0 || descendant {
+		return nil, errors.New("path has no element name at the end")
+	}
+	return steps, nil
+}
+
+func parseJSONPath(expression string) ([]jsonPathStep, error) {
+	steps := []jsonPathStep{}
+	rest := expression[1:]
+
+	for rest != "" {
+		step := jsonPathStep{}
+
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			step.descendant = true
+			rest = rest[2:]
+			if strings.HasPrefix(rest, "[") {
+				break
+			}
+			fallthrough
+		case strings.HasPrefix(rest, "."):
+			rest = strings.TrimPrefix(rest, ".")
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			name := rest[:end]
+			rest = rest[end:]
+
+			switch name {
+			case "":
+				return nil, errors.New("empty key")
+			case "*":
+				step.any = true
+			default:
+				step.key = name
+			}
+			steps = append(steps, step)
+			continue
+		case !strings.HasPrefix(rest, "["):
+			return nil, fmt.Errorf("unexpected [%s]", rest)
+		}
+
+		end := strings.Index(rest, "]")
+		if end < 0 {
+			return nil, errors.New("missing ]")
+		}
+		inner := strings.TrimSpace(rest[1:end])
+		rest = rest[end+1:]
+
+		switch {
+		case inner == "*":
+			step.any = true
+		case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+			step.key = inner[1 : len(inner)-1]
+		default:
+			index, err := strconv.Atoi(inner)
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("unsupported selector [%s]", inner)
+			}
+			step.index = index
+			step.isIndex = true
+		}
+		steps = append(steps, step)
+	}
+
+	if len(steps) == 0 {
+		return nil, errors.New("path selects the whole document")
+	}
+	return steps, nil
+}
+
+func matchXMLSteps(steps []xmlPathStep, names []string) bool {
+	if len(steps) == 0 {
+		return len(names) == 0
+	}
+
+	step := steps[0]
+	matches := func(name string) bool {
+		return step.name == "*" || step.name == name
+	}
+
+	if step.descendant {
+		for i := range names {
+			if matches(names[i]) && matchXMLSteps(steps[1:], names[i+1:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return len(names) > 0 && matches(names[0]) && matchXMLSteps(steps[1:], names[1:])
+}
+
+func matchJSONSteps(steps []jsonPathStep, path []jsonPathComponent) bool {
+	if len(steps) == 0 {
+		return len(path) == 0
+	}
+
+	step := steps[0]
+	matches := func(component jsonPathComponent) bool {
+		switch {
+		case step.any:
+			return true
+		case step.isIndex:
+			return component.isIndex && component.index == step.index
+		default:
+			return !component.isIndex && component.key == step.key
+		}
+	}
+
+	if step.descendant {
+		for i := range path {
+			if matches(path[i]) && matchJSONSteps(steps[1:], path[i+1:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return len(path) > 0 && matches(path[0]) && matchJSONSteps(steps[1:], path[1:])
+}
+
+func findXMLPath(data []byte, steps []xmlPathStep) ([]PathMatch, error) {
+	type frame struct {
+		name         string
+		start        int64
+		elementStart int64
+		text         strings.Builder
+		matched      bool
+		match        int // position of the match in results
+	}
+
+	matches := []PathMatch{}
+	stack := []*frame{}
+	names := []string{}
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		before := decoder.InputOffset()
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			names = append(names, t.Name.Local)
+			current := &frame{name: t.Name.Local, start: decoder.InputOffset(), elementStart: before}
+			if matchXMLSteps(steps, names) {
+				// placeholder keeps document order for nested matches
+				current.matched = true
+				current.match = len(matches)
+				matches = append(matches, PathMatch{Path: "/" + strings.Join(names, "/"), Name: t.Name.Local})
+			}
+			stack = append(stack, current)
+
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text.Write(t)
+			}
+
+		case xml.EndElement:
+			current := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			names = names[:len(names)-1]
+
+			if current.matched {
+				matches[current.match].Value = current.text.String()
+				matches[current.match].Start = current.start
+				matches[current.match].End = before
+				matches[current.match].ElementStart = current.elementStart
+				matches[current.match].ElementEnd = decoder.InputOffset()
+			}
+		}
+	}
+
+	return matches, nil
+}
+
+func findJSONPath(data []byte, steps []jsonPathStep) ([]PathMatch, error) {
+	type frame struct {
+		object    bool
+		component jsonPathComponent
+		expectKey bool
+		start     int64
+		matched   bool
+		match     int
+	}
+
+	matches := []PathMatch{}
+	stack := []*frame{}
+
+	path := func() []jsonPathComponent {
+		result := make([]jsonPathComponent, len(stack))
+		for i := range stack {
+			result[i] = stack[i].component
+		}
+		return result
+	}
+	describe := func(components []jsonPathComponent) (string, string) {
+		text, name := "$", ""
+		for _, c := range components {
+			if c.isIndex {
+				text += fmt.Sprintf("[%d]", c.index)
+			} else {
+				text += "." + c.key
+				name = c.key
+			}
+		}
+		return text, name
+	}
+	// value in the container is complete
+	advance := func() {
+		if len(stack) == 0 {
+			return
+		}
+		top := stack[len(stack)-1]
+		if top.object {
+			top.expectKey = true
+		} else {
+			top.component.index++
+		}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	for {
+		before := decoder.InputOffset()
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		start := skipJSONSeparators(data, before)
+		end := decoder.InputOffset()
+
+		if len(stack) > 0 && stack[len(stack)-1].object && stack[len(stack)-1].expectKey {
+			if key, ok := token.(string); ok {
+				top := stack[len(stack)-1]
+				top.component = jsonPathComponent{key: key}
+				top.expectKey = false
+				continue
+			}
+		}
+
+		switch t := token.(type) {
+		case json.Delim:
+			switch t {
+			case '{', '[':
+				current := &frame{object: t == '{', expectKey: t == '{', start: start}
+				components := path()
+				if matchJSONSteps(steps, components) {
+					text, name := describe(components)
+					current.matched = true
+					current.match = len(matches)
+					matches = append(matches, PathMatch{Path: text, Name: name})
+				}
+				if !current.object {
+					current.component = jsonPathComponent{isIndex: true}
+				}
+				stack = append(stack, current)
+
+			case '}', ']':
+				current := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				if current.matched {
+					matches[current.match].Value = string(data[current.start:end])
+					matches[current.match].Start = current.start
+					matches[current.match].End = end
+					matches[current.match].ElementStart = current.start
+					matches[current.match].ElementEnd = end
+				}
+				advance()
+			}
+
+		default:
+			components := path()
+			if matchJSONSteps(steps, components) {
+				text, name := describe(components)
+				value := fmt.Sprint(t)
+				if t == nil {
+					value = "null"
+				}
+				matches = append(matches, PathMatch{Path: text, Name: name, Value: value, Start: start, End: end, ElementStart: start, ElementEnd: end})
+			}
+			advance()
+		}
+	}
+
+	return matches, nil
+}
+
+// skipJSONSeparators moves offset from the end of previous token to the start of the next one
+func skipJSONSeparators(data []byte, offset int64) int64 {
+	for offset < int64(len(data)) && strings.IndexByte(" \t\r\n,:", data[offset]) >= 0 {
+		offset++
+	}
+	return offset
+}
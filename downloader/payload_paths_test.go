@@ -0,0 +1,65 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestPayloadPath(t *testing.T) {
+	xmlDocument := `<?xml version="1.0"?><ns0:Invoice xmlns:ns0="urn:x"><Number>42</Number><Attachment><Name>a.pdf</Name><Data>QUJD</Data></Attachment><Attachment><Data>REVG</Data></Attachment><Note>x &amp; y</Note></ns0:Invoice>`
+	jsonDocument := `{"number": 42, "files": [{"name": "a.pdf", "content": "QUJD"}, {"content": "REVG", "meta": {"content": null}}], "note": "x \"y\""}`
+
+	tests := []struct {
+		Index    string
+		Path     string
+		Document string
+		Values   []string
+		Raw      []string
+		Error    bool
+	}{
+		{"01", "/Invoice/Attachment/Data", xmlDocument, []string{"QUJD", "REVG"}, []string{"QUJD", "REVG"}, false},
+		{"02", "//Data", xmlDocument, []string{"QUJD", "REVG"}, []string{"QUJD", "REVG"}, false},
+		{"03", "Attachment/Name", xmlDocument, []string{"a.pdf"}, []string{"a.pdf"}, false},
+		{"04", "/ns0:Invoice/*/Data/text()", xmlDocument, []string{"QUJD", "REVG"}, []string{"QUJD", "REVG"}, false},
+		{"05", "//Note", xmlDocument, []string{"x & y"}, []string{"x &amp; y"}, false},
+		{"06", "/Data", xmlDocument, []string(nil), []string(nil), false},
+		{"07", "//Attachment[1]", xmlDocument, nil, nil, true},
+		{"08", "$.files[*].content", jsonDocument, []string{"QUJD", "REVG"}, []string{`"QUJD"`, `"REVG"`}, false},
+		{"09", "$..content", jsonDocument, []string{"QUJD", "REVG", "null"}, []string{`"QUJD"`, `"REVG"`, "null"}, false},
+		{"10", "$['files'][1].meta", jsonDocument, []string{`{"content": null}`}, []string{`{"content": null}`}, false},
+		{"11", "$.number", jsonDocument, []string{"42"}, []string{"42"}, false},
+		{"12", "$.note", jsonDocument, []string{`x "y"`}, []string{`"x \"y\""`}, false},
+		{"13", "$.files[0].*", jsonDocument, []string{"a.pdf", "QUJD"}, []string{`"a.pdf"`, `"QUJD"`}, false},
+		{"14", "$", jsonDocument, nil, nil, true},
+		{"15", "$.files[x]", jsonDocument, nil, nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Index, func(t *testing.T) {
+			path, err := parsePayloadPath(test.Path)
+			if (err != nil) != test.Error {
+				t.Fatalf(`Unexpected error: %v`, err)
+			}
+			if err != nil {
+				return
+			}
+
+			matches, err := path.Find([]byte(test.Document))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var values, raw []string
+			for _, match := range matches {
+				values = append(values, match.Value)
+				raw = append(raw, test.Document[match.Start:match.End])
+			}
+			t.Logf(`Values: %#v`, values)
+			t.Logf(`Raw   : %#v`, raw)
+
+			if !slices.Equal(values, test.Values) || !slices.Equal(raw, test.Raw) {
+				t.Fail()
+			}
+		})
+	}
+}
@@ -0,0 +1,454 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+type RedactionAction string
+
+const (
+	RedactionReplace RedactionAction = "replace"
+	RedactionHash                    = "hash"
+	RedactionDrop                    = "drop"
+)
+
+// used by "replace" without explicit value
+const RedactionDefaultReplacement string = "***"
+
+// length of hex digest used by "hash", enough to correlate values between messages
+const redactionHashLength int = 16
+
+// RedactionRule is one line of -redact rules file: <name> <action> <kind>:<expression>
+type RedactionRule struct {
+	Name        string
+	Action      RedactionAction
+	Replacement string // value for "replace"
+	Key         []byte // secret of "hash"
+	Selector    string
+	Path        PayloadPath    // xpath and jsonpath rules
+	Pattern     *regexp.Regexp // regex rules
+}
+
+type redactionEdit struct {
+	start       int
+	end         int
+	replacement []byte
+	rule        string
+}
+
+// number of values redacted by each rule
+var redactionHits namedCounter
+
+func loadRedactionRules(filename string) ([]RedactionRule, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot read redaction rules file [%s]: %s", filename, err)
+	}
+
+	rules := []RedactionRule{}
+	names := make(map[string]bool)
+
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		rule, err := parseRedactionRule(line)
+		if err != nil {
+			return nil, fmt.Errorf("Redaction rule at line %d is incorrect: %s", i+1, err)
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("Redaction rule at line %d is incorrect: name [%s] is used twice", i+1, rule.Name)
+		}
+		names[rule.Name] = true
+		rules = append(rules, rule)
+	}
+
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("Redaction rules file [%s] has no rules", filename)
+	}
+	return rules, nil
+}
+
+func parseRedactionRule(line string) (RedactionRule, error) {
+	cut := func(s string) (string, string) {
+		s = strings.TrimSpace(s)
+		if i := strings.IndexAny(s, " \t"); i >= 0 {
+			return s[:i], strings.TrimSpace(s[i:])
+		}
+		return s, ""
+	}
+
+	name, rest := cut(line)
+	action, selector := cut(rest)
+	if selector == "" {
+		return RedactionRule{}, fmt.Errorf("expected <name> <action> <kind>:<expression>, got [%s]", line)
+	}
+
+	rule := RedactionRule{Name: name, Selector: selector}
+
+	action, value, hasValue := strings.Cut(action, "=")
+	switch RedactionAction(strings.ToLower(action)) {
+	case RedactionReplace:
+		rule.Action = RedactionReplace
+		rule.Replacement = RedactionDefaultReplacement
+		if hasValue {
+			rule.Replacement = value
+		}
+	case RedactionHash:
+		// unkeyed digest of IBAN, account number or name is reversed with a dictionary
+		if value == "" {
+			return RedactionRule{}, fmt.Errorf("action [hash] requires a key: hash=<key>, hash=file:<path> or hash=env:<variable>")
+		}
+		key, err := resolveSecret(value)
+		if err != nil {
+			return RedactionRule{}, err
+		}
+		rule.Action = RedactionHash
+		rule.Key = key
+	case RedactionDrop:
+		if hasValue {
+			return RedactionRule{}, fmt.Errorf("action [drop] takes no value")
+		}
+		rule.Action = RedactionDrop
+	default:
+		return RedactionRule{}, fmt.Errorf("unsupported action [%s], use replace, replace=<text>, hash or drop", action)
+	}
+
+	path, pattern, err := parseContentSelector(selector)
+	if err != nil {
+		return RedactionRule{}, err
+	}
+	rule.Path = path
+	rule.Pattern = pattern
+
+	return rule, nil
+}
+
+func (rule RedactionRule) hash(value string) string {
+	mac := hmac.New(sha256.New, rule.Key)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))[:redactionHashLength]
+}
+
+// pathEdit replaces contents of XML element (or the whole element for "drop"),
+// JSON values are replaced with strings or null
+func (rule RedactionRule) pathEdit(match PathMatch, isJSON bool) redactionEdit {
+	edit := redactionEdit{start: int(match.Start), end: int(match.End), rule: rule.Name}
+
+	value := ""
+	switch rule.Action {
+	case RedactionReplace:
+		value = rule.Replacement
+	case RedactionHash:
+		value = rule.hash(match.Value)
+	case RedactionDrop:
+		if isJSON {
+			edit.replacement = []byte("null")
+		} else {
+			edit.start, edit.end = int(match.ElementStart), int(match.ElementEnd)
+		}
+		return edit
+	}
+
+	if isJSON {
+		edit.replacement, _ = json.Marshal(value)
+	} else {
+		edit.replacement = []byte(escapeXMLText(value, false))
+	}
+	return edit
+}
+
+// startRedactor puts Redactor between unpacker and writer if any rules are configured.
+// Returns channel to be consumed by the writer.
+func startRedactor(options RuntimeConfiguration, payloadChan chan XIMessagePayloads) chan XIMessagePayloads {
+	if len(options.RedactionRules) == 0 {
+		return payloadChan
+	}
+
+	writerChan := make(chan XIMessagePayloads, cap(payloadChan))
+	wgRedactors.Add(1)
+	go Redactor(options, payloadChan, writerChan)
+
+	watchQueue("redacted", func() int { return len(writerChan) }, cap(writerChan))
+	return writerChan
+}
+
+// Redactor applies -redact rules to all parts of the message before they are written
+func Redactor(options RuntimeConfiguration, payloadChan <-chan XIMessagePayloads, writerChan chan<- XIMessagePayloads) {
+	defer wgRedactors.Done()
+
+	stageRedact.Workers = 1
+	for entry := range payloadChan {
+		started := time.Now()
+		redactPayloads(options.RedactionRules, &entry)
+		stageRedact.Add(entry.Size(), started)
+		writerChan <- entry
+	}
+}
+
+func redactPayloads(rules []RedactionRule, payloads *XIMessagePayloads) {
+	for i := range payloads.Parts {
+		part := &payloads.Parts[i]
+		hits := make(map[string]int)
+
+		var err error
+		if part.Kind == PayloadKindRaw {
+			part.Contents, err = redactMultipart(rules, part.Contents, hits)
+		} else {
+			part.Contents, err = redactContents(rules, part.ContentType, part.Contents, hits)
+		}
+		if err != nil {
+			payloads.Diagnose("redaction of [%s] is incomplete: %s", part.Name, err)
+		}
+
+		for _, rule := range rules {
+			if hits[rule.Name] > 0 {
+				part.Notes = append(part.Notes, fmt.Sprintf("redacted:%s=%d", rule.Name, hits[rule.Name]))
+				redactionHits.Add(rule.Name, hits[rule.Name])
+			}
+		}
+	}
+
+	// parsed header is exported to dynamic_configuration.csv
+	if payloads.Header != nil {
+		data, err := payloads.Header.JSON()
+		if err == nil {
+			data, err = redactContents(rules, "application/json", data, make(map[string]int))
+		}
+		header := XIHeader{}
+		if err == nil {
+			err = json.Unmarshal(data, &header)
+		}
+		if err != nil {
+			payloads.Diagnose("redaction of XI header is incomplete, dynamic configuration is not exported: %s", err)
+			payloads.Header = nil
+		} else {
+			payloads.Header = &header
+		}
+	}
+}
+
+// redactContents applies path rules to XML and JSON contents and regex rules to any
+// contents except binary formats
+func redactContents(rules []RedactionRule, contentType string, data []byte, hits map[string]int) ([]byte, error) {
+	ext, _ := inferExtension(contentType, data)
+	if slices.Contains(embeddedAutoExtensions, ext) {
+		return data, nil
+	}
+
+	var failure error
+	if ext == ".xml" || ext == ".json" {
+		edits := []redactionEdit{}
+		for _, rule := range rules {
+			if rule.Pattern != nil || rule.Path.IsJSON() != (ext == ".json") {
+				continue
+			}
+
+			matches, err := rule.Path.Find(data)
+			if err != nil {
+				// values found by other rules are still redacted
+				failure = fmt.Errorf("rule [%s] cannot be applied: %s", rule.Name, err)
+				continue
+			}
+			for _, match := range matches {
+				edits = append(edits, rule.pathEdit(match, ext == ".json"))
+			}
+		}
+		data = applyRedactionEdits(data, edits, hits)
+	}
+
+	return redactText(rules, data, hits), failure
+}
+
+// redactText applies regex rules. If expression has groups, only the first group is replaced.
+func redactText(rules []RedactionRule, data []byte, hits map[string]int) []byte {
+	for _, rule := range rules {
+		if rule.Pattern == nil {
+			continue
+		}
+
+		edits := []redactionEdit{}
+		for _, loc := range rule.Pattern.FindAllSubmatchIndex(data, -1) {
+			start, end := loc[0], loc[1]
+			if len(loc) > 2 && loc[2] >= 0 {
+				start, end = loc[2], loc[3]
+			}
+			if start == end {
+				continue
+			}
+
+			edit := redactionEdit{start: start, end: end, rule: rule.Name}
+			switch rule.Action {
+			case RedactionReplace:
+				edit.replacement = []byte(rule.Replacement)
+			case RedactionHash:
+				edit.replacement = []byte(rule.hash(string(data[start:end])))
+			}
+			edits = append(edits, edit)
+		}
+		data = applyRedactionEdits(data, edits, hits)
+	}
+	return data
+}
+
+// applyRedactionEdits replaces ranges of data. Ranges nested in already replaced ones
+// (e.g. //Customer and //Customer/Name) are skipped.
+func applyRedactionEdits(data []byte, edits []redactionEdit, hits map[string]int) []byte {
+	if len(edits) == 0 {
+		return data
+	}
+
+	slices.SortStableFunc(edits, func(a, b redactionEdit) int {
+		if a.start != b.start {
+			return a.start - b.start
+		}
+		return b.end - a.end
+	})
+
+	result := make([]byte, 0, len(data))
+	pos := 0
+	for _, edit := range edits {
+		if edit.start < pos {
+			continue
+		}
+		result = append(result, data[pos:edit.start]...)
+		result = append(result, edit.replacement...)
+		pos = edit.end
+		hits[edit.rule]++
+	}
+	return append(result, data[pos:]...)
+}
+
+// redactMultipart applies rules to each part of raw multipart message. Part headers
+// are handled as text, encoded parts are decoded and encoded again.
+func redactMultipart(rules []RedactionRule, data []byte, hits map[string]int) ([]byte, error) {
+	headers, body, _ := parseMessageHeaders(data)
+	_, params, err := mime.ParseMediaType(headers.Get("Content-Type"))
+	if err != nil || params["boundary"] == "" {
+		return redactText(rules, data, hits), nil
+	}
+
+	delimiter := []byte("--" + params["boundary"])
+	pos := len(data) - len(body)
+	result := redactText(rules, data[:pos], hits)
+
+	var failure error
+	for {
+		start := indexDelimiter(data, pos, delimiter)
+		if start < 0 {
+			result = append(result, redactText(rules, data[pos:], hits)...)
+			break
+		}
+
+		// line break before delimiter belongs to delimiter
+		contentsEnd := start
+		if contentsEnd > pos && data[contentsEnd-1] == '\n' {
+			contentsEnd--
+		}
+		if contentsEnd > pos && data[contentsEnd-1] == '\r' {
+			contentsEnd--
+		}
+
+		redacted, err := redactPart(rules, data[pos:contentsEnd], hits, pos == len(data)-len(body))
+		if err != nil && failure == nil {
+			failure = err
+		}
+		result = append(result, redacted...)
+
+		_, next, _ := nextHeaderLine(data, start)
+		result = append(result, data[contentsEnd:next]...)
+		pos = next
+
+		if bytes.HasPrefix(data[start+len(delimiter):], []byte("--")) {
+			// closing delimiter, anything after it is epilogue
+			result = append(result, redactText(rules, data[pos:], hits)...)
+			break
+		}
+	}
+
+	return result, failure
+}
+
+func redactPart(rules []RedactionRule, data []byte, hits map[string]int, preamble bool) ([]byte, error) {
+	if preamble || len(data) == 0 {
+		return redactText(rules, data, hits), nil
+	}
+
+	headers, body, _ := parseMessageHeaders(data)
+	if body == nil {
+		return redactText(rules, data, hits), nil
+	}
+
+	offset := len(data) - len(body)
+	result := redactText(rules, data[:offset], hits)
+
+	encoding := strings.ToLower(strings.TrimSpace(headers.Get("Content-Transfer-Encoding")))
+	decoded, wasDecoded, err := decodeTransferEncoding(encoding, body)
+	if err != nil {
+		return append(result, body...), fmt.Errorf("part [%s] cannot be decoded: %s", headers.Get("Content-Id"), err)
+	}
+
+	redacted, err := redactContents(rules, headers.Get("Content-Type"), decoded, hits)
+	switch {
+	case !wasDecoded:
+		return append(result, redacted...), err
+	case bytes.Equal(redacted, decoded):
+		// encoded contents are kept as is
+		return append(result, body...), err
+	}
+	return append(result, encodeTransferEncoding(encoding, redacted)...), err
+}
+
+// indexDelimiter finds multipart delimiter at the line start
+func indexDelimiter(data []byte, pos int, delimiter []byte) int {
+	for {
+		idx := bytes.Index(data[pos:], delimiter)
+		if idx < 0 {
+			return -1
+		}
+		start := pos + idx
+		if start == 0 || data[start-1] == '\n' || data[start-1] == '\r' {
+			return start
+		}
+		pos = start + len(delimiter)
+	}
+}
+
+// encodeTransferEncoding is reverse of decodeTransferEncoding for base64 and quoted-printable
+func encodeTransferEncoding(encoding string, data []byte) []byte {
+	buffer := new(bytes.Buffer)
+
+	switch encoding {
+	case TransferEncodingBase64:
+		encoded := base64.StdEncoding.EncodeToString(data)
+		for len(encoded) > 76 {
+			buffer.WriteString(encoded[:76] + "\r\n")
+			encoded = encoded[76:]
+		}
+		buffer.WriteString(encoded)
+	case TransferEncodingQuotedPrintable:
+		w := quotedprintable.NewWriter(buffer)
+		w.Binary = true // line breaks of contents are kept as is
+		w.Write(data)
+		w.Close()
+	default:
+		return data
+	}
+
+	return buffer.Bytes()
+}
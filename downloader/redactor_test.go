@@ -0,0 +1,181 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseRedactionRule(t *testing.T) {
+	tests := []struct {
+		Index       string
+		Line        string
+		Action      RedactionAction
+		Replacement string
+		Error       bool
+	}{
+		{"01", "iban hash regex:[A-Z]{2}\\d{2}[A-Z0-9]{11,30}", "", "", true},
+		{"02", "name replace=XXX xpath://Customer/Name", RedactionReplace, "XXX", false},
+		{"03", "name\treplace\txpath://Customer/Name", RedactionReplace, RedactionDefaultReplacement, false},
+		{"04", "card drop jsonpath:$..cardNumber", RedactionDrop, "", false},
+		{"05", "phone hash=s3cret regex:\\+\\d[\\d ]{7,}", RedactionHash, "s3cret", false},
+		{"06", "name replace", "", "", true},
+		{"07", "name mask xpath://Name", "", "", true},
+		{"08", "name drop=x xpath://Name", "", "", true},
+		{"09", "name drop xpath:$.name", "", "", true},
+		{"10", "name drop jsonpath://Name", "", "", true},
+		{"11", "name drop regex:[", "", "", true},
+		{"12", "name drop sql:select", "", "", true},
+		{"13", "iban hash=env:REDACTION_TEST_KEY regex:DE\\d+", RedactionHash, "from env", false},
+		{"14", "iban hash=env:REDACTION_TEST_KEY_MISSING regex:DE\\d+", "", "", true},
+	}
+
+	t.Setenv("REDACTION_TEST_KEY", "from env")
+
+	for _, test := range tests {
+		t.Run(test.Index, func(t *testing.T) {
+			rule, err := parseRedactionRule(test.Line)
+			t.Logf(`Rule: %#v, error: %v`, rule, err)
+
+			if (err != nil) != test.Error {
+				t.Fatal(`Unexpected error`)
+			}
+			value := rule.Replacement
+			if rule.Action == RedactionHash {
+				value = string(rule.Key)
+			}
+			if err == nil && (rule.Action != test.Action || value != test.Replacement) {
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestRedactContents(t *testing.T) {
+	xmlPayload := `<Order><Customer><Name>Jane &amp; Joe</Name><IBAN>DE89370400440532013000</IBAN></Customer><Note>call +49 170 1234567</Note></Order>`
+	jsonPayload := `{"customer": {"name": "John Roe", "iban": "GB82WEST12345698765432"}, "tags": ["a"]}`
+
+	tests := []struct {
+		Index    string
+		Rules    []string
+		Payload  string
+		Expected string
+		Hits     int
+	}{
+		{"01", []string{"name replace=<hidden> xpath://Name"}, xmlPayload,
+			`<Order><Customer><Name>&lt;hidden&gt;</Name><IBAN>DE89370400440532013000</IBAN></Customer><Note>call +49 170 1234567</Note></Order>`, 1},
+		{"02", []string{"iban drop xpath:/Order/Customer/IBAN"}, xmlPayload,
+			`<Order><Customer><Name>Jane &amp; Joe</Name></Customer><Note>call +49 170 1234567</Note></Order>`, 1},
+		{"03", []string{"customer replace xpath://Customer", "name replace=x xpath://Name"}, xmlPayload,
+			`<Order><Customer>***</Customer><Note>call +49 170 1234567</Note></Order>`, 1},
+		{"04", []string{"name hash=s3cret xpath://Name"}, xmlPayload,
+			`<Order><Customer><Name>d4f6f396ae2f11cc</Name><IBAN>DE89370400440532013000</IBAN></Customer><Note>call +49 170 1234567</Note></Order>`, 1},
+		{"05", []string{"phone replace=[phone] regex:\\+\\d[\\d ]{7,}\\d"}, xmlPayload,
+			`<Order><Customer><Name>Jane &amp; Joe</Name><IBAN>DE89370400440532013000</IBAN></Customer><Note>call [phone]</Note></Order>`, 1},
+		{"06", []string{"iban drop regex:<IBAN>DE(\\d+)</IBAN>"}, xmlPayload,
+			`<Order><Customer><Name>Jane &amp; Joe</Name><IBAN>DE</IBAN></Customer><Note>call +49 170 1234567</Note></Order>`, 1},
+		{"07", []string{"name replace=\"X\" jsonpath:$..name", "iban drop jsonpath:$.customer.iban"}, jsonPayload,
+			`{"customer": {"name": "\"X\"", "iban": null}, "tags": ["a"]}`, 2},
+		{"08", []string{"name replace xpath://Name"}, jsonPayload, jsonPayload, 0},
+		{"09", []string{"tags replace jsonpath:$.tags"}, jsonPayload,
+			`{"customer": {"name": "John Roe", "iban": "GB82WEST12345698765432"}, "tags": "***"}`, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Index, func(t *testing.T) {
+			rules := []RedactionRule{}
+			for _, line := range test.Rules {
+				rule, err := parseRedactionRule(line)
+				if err != nil {
+					t.Fatal(err)
+				}
+				rules = append(rules, rule)
+			}
+
+			hits := make(map[string]int)
+			result, err := redactContents(rules, "", []byte(test.Payload), hits)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			total := 0
+			for _, n := range hits {
+				total += n
+			}
+			t.Logf(`Result: %s`, result)
+			t.Logf(`Hits  : %#v`, hits)
+
+			if string(result) != test.Expected || total != test.Hits {
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestRedactPayloads(t *testing.T) {
+	quietDiagnostics = true
+	defer func() { quietDiagnostics = false }()
+
+	rules := []RedactionRule{}
+	for _, line := range []string{
+		"name replace=REDACTED xpath://Customer/Name",
+		"iban hash=s3cret regex:\\b[A-Z]{2}\\d{2}[A-Z0-9]{11,30}\\b",
+		"jsonname replace=REDACTED jsonpath:$.customer.name",
+		"words replace=XXX regex:Bestellung",
+		"file replace regex:ORDERS_\\d+_\\d+",
+	} {
+		rule, err := parseRedactionRule(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rules = append(rules, rule)
+	}
+
+	tests := []struct {
+		Filename string
+		Secrets  []string
+		Notes    []string // notes of RAW part
+	}{
+		{"01.async.xml.testdata", []string{"Jane Doe", "DE89370400440532013000", "ORDERS_20231121_0001"}, []string{"redacted:name=1", "redacted:iban=1", "redacted:file=1"}},
+		{"03.attachments.testdata", []string{"Jane Doe", "DE89370400440532013000", "Bestellung"}, []string{"redacted:name=1", "redacted:iban=1", "redacted:words=1"}},
+		{"04.lf.json.testdata", []string{"John Roe", "GB82WEST12345698765432"}, []string{"redacted:iban=1", "redacted:jsonname=1"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Filename, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", "messages", test.Filename))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			options := RuntimeConfiguration{SaveRawContent: true, SaveXIHeader: true, SaveHeaderJSON: true}
+			payloads := UnpackParts(options, testMessageVersion(), data)
+			redactPayloads(rules, &payloads)
+
+			for _, part := range payloads.Parts {
+				for _, secret := range test.Secrets {
+					if strings.Contains(string(part.Contents), secret) {
+						t.Errorf(`Part [%s] contains [%s]`, part.Name, secret)
+					}
+				}
+			}
+			if payloads.Header == nil || strings.Contains(payloads.Header.DynamicConfigurationValue("FileName"), "ORDERS_") {
+				t.Errorf(`XI header is not redacted`)
+			}
+			t.Logf(`RAW notes  : %#v`, payloads.Parts[0].Notes)
+			t.Logf(`Diagnostics: %#v`, payloads.Diagnostics)
+
+			if !slices.Equal(payloads.Parts[0].Notes, test.Notes) || len(payloads.Diagnostics) != 0 {
+				t.Fail()
+			}
+
+			// RAW is still a valid message
+			unpacked := UnpackParts(RuntimeConfiguration{}, testMessageVersion(), payloads.Parts[0].Contents)
+			if len(unpacked.Diagnostics) != 0 || len(unpacked.Parts) == 0 {
+				t.Errorf(`Redacted RAW cannot be unpacked: %#v`, unpacked.Diagnostics)
+			}
+		})
+	}
+}
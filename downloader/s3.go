@@ -0,0 +1,390 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// S3Target is a bucket of S3-compatible storage (AWS, MinIO, etc) where export is uploaded (-s3)
+type S3Target struct {
+	Endpoint  string // scheme://host[:port]
+	Bucket    string
+	Prefix    string // prefix of object keys, without trailing slash
+	Region    string
+	AccessKey string
+	SecretKey string
+	PartSize  int64 // files larger than part are uploaded with multipart upload
+}
+
+const (
+	S3DefaultRegion  string = "us-east-1"
+	s3MinPartSize    int64  = 5 * 1024 * 1024
+	s3UploadThreads  int    = 4
+	awsSigningAlgo   string = "AWS4-HMAC-SHA256"
+	awsTimeFormat    string = "20060102T150405Z"
+	awsDateFormat    string = "20060102"
+	awsContentSHA256 string = "x-amz-content-sha256"
+)
+
+var s3Client = &http.Client{Timeout: 10 * time.Minute}
+
+// GetS3Config reads S3 connection file: bucket URL with optional prefix, access key
+// and secret key. Keys can be omitted to use AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY.
+func GetS3Config(filename string, region string, partSize int64) (S3Target, error) {
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		return S3Target{}, fmt.Errorf("S3 connection file [%s] not found", filename)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(contents)), "\n")
+	if len(lines) > 3 {
+		return S3Target{}, fmt.Errorf("S3 connection file [%s] is incorrect", filename)
+	}
+	for len(lines) < 3 {
+		lines = append(lines, "")
+	}
+
+	parsedURL, err := url.Parse(strings.TrimSpace(lines[0]))
+	if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+		return S3Target{}, fmt.Errorf("S3 connection file [%s] contains invalid URL specification [%s]", filename, strings.TrimSpace(lines[0]))
+	}
+
+	bucket, prefix, _ := strings.Cut(strings.Trim(parsedURL.Path, "/"), "/")
+	if bucket == "" {
+		return S3Target{}, fmt.Errorf("S3 connection file [%s] contains no bucket in URL [%s]", filename, strings.TrimSpace(lines[0]))
+	}
+
+	target := S3Target{
+		Endpoint:  fmt.Sprintf("%s://%s", parsedURL.Scheme, parsedURL.Host),
+		Bucket:    bucket,
+		Prefix:    strings.Trim(prefix, "/"),
+		Region:    region,
+		AccessKey: firstNonEmpty(strings.TrimSpace(lines[1]), os.Getenv("AWS_ACCESS_KEY_ID")),
+		SecretKey: firstNonEmpty(strings.TrimSpace(lines[2]), os.Getenv("AWS_SECRET_ACCESS_KEY")),
+		PartSize:  max(partSize, s3MinPartSize),
+	}
+	if target.Region == "" {
+		target.Region = S3DefaultRegion
+	}
+
+	if target.AccessKey == "" || target.SecretKey == "" {
+		return S3Target{}, fmt.Errorf("S3 connection file [%s] is incorrect, access key or secret key are not provided", filename)
+	}
+	return target, nil
+}
+
+// uploadExport uploads all files of the export folder to S3, keeping their paths below
+// -output as object keys. Returns error if any file is not uploaded.
+func uploadExport(options RuntimeConfiguration, export *Export) error {
+	if options.S3 == nil || options.StatisticsOnly {
+		return nil
+	}
+
+	var failed int32
+
+	files := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < s3UploadThreads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range files {
+				relative, _ := filepath.Rel(options.OutputRoot, name)
+				key := options.S3.ObjectKey(export.Key, filepath.ToSlash(relative))
+				size, err := options.S3.UploadFile(name, key)
+				if err != nil {
+					fmt.Printf("Failed uploading file [%s] to S3: %s\n", name, err)
+					atomic.AddInt32(&export.Stats.FilesUploadFailed, 1)
+					atomic.AddInt32(&failed, 1)
+					continue
+				}
+				atomic.AddInt32(&export.Stats.FilesUploaded, 1)
+				atomic.AddInt64(&export.Stats.BytesUploaded, size)
+			}
+		}()
+	}
+
+	err := filepath.WalkDir(options.OutputRoot, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			fmt.Printf("Cannot read [%s]: %s\n", name, err)
+			atomic.AddInt32(&failed, 1)
+			return nil
+		}
+		if d.Type().IsRegular() {
+			files <- name
+		}
+		return nil
+	})
+	close(files)
+	wg.Wait()
+
+	if err != nil {
+		return fmt.Errorf("Failed uploading export to S3: %s", err)
+	}
+	if failed > 0 {
+		return fmt.Errorf("Failed uploading %d files of export to S3", failed)
+	}
+	return nil
+}
+
+func (s S3Target) ObjectKey(folder string, name string) string {
+	key := strings.Trim(folder+"/"+name, "/")
+	if s.Prefix != "" {
+		key = s.Prefix + "/" + key
+	}
+	return key
+}
+
+// UploadFile uploads file with single PUT or with multipart upload if it is larger
+// than PartSize. Returns size of the file.
+func (s S3Target) UploadFile(name string, key string) (int64, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	if info.Size() <= s.PartSize {
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return 0, err
+		}
+		_, err = s.do(http.MethodPut, key, nil, data)
+		return info.Size(), err
+	}
+
+	return info.Size(), s.uploadMultipart(file, key)
+}
+
+type s3InitiateMultipartUploadResult struct {
+	UploadId string
+}
+
+type s3CompletedPart struct {
+	PartNumber int
+	ETag       string
+}
+
+type s3CompleteMultipartUpload struct {
+	XMLName xml.Name          `xml:"CompleteMultipartUpload"`
+	Parts   []s3CompletedPart `xml:"Part"`
+}
+
+// s3Error is returned e.g. by CompleteMultipartUpload with HTTP 200
+type s3Error struct {
+	XMLName xml.Name
+	Code    string
+	Message string
+}
+
+func (s S3Target) uploadMultipart(input io.Reader, key string) error {
+	response, err := s.do(http.MethodPost, key, url.Values{"uploads": {""}}, nil)
+	if err != nil {
+		return err
+	}
+
+	initiated := s3InitiateMultipartUploadResult{}
+	err = xml.Unmarshal(response.Body, &initiated)
+	if err != nil || initiated.UploadId == "" {
+		return fmt.Errorf("Cannot parse response of multipart upload: %s", response.Body)
+	}
+
+	complete := s3CompleteMultipartUpload{}
+	buffer := make([]byte, s.PartSize)
+
+	for number := 1; ; number++ {
+		n, err := io.ReadFull(input, buffer)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			s.abortMultipart(key, initiated.UploadId)
+			return err
+		}
+
+		query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {initiated.UploadId}}
+		response, err := s.do(http.MethodPut, key, query, buffer[:n])
+		if err != nil {
+			s.abortMultipart(key, initiated.UploadId)
+			return fmt.Errorf("Part %d: %s", number, err)
+		}
+		complete.Parts = append(complete.Parts, s3CompletedPart{number, response.Header.Get("ETag")})
+	}
+
+	body, err := xml.Marshal(complete)
+	if err == nil {
+		response, err = s.do(http.MethodPost, key, url.Values{"uploadId": {initiated.UploadId}}, body)
+	}
+	if err == nil {
+		// S3 reports failure of the request with HTTP 200 once it started sending the response
+		failure := s3Error{}
+		if xml.Unmarshal(response.Body, &failure) == nil && failure.XMLName.Local == "Error" {
+			err = fmt.Errorf("Multipart upload is not completed: %s %s", failure.Code, failure.Message)
+		}
+	}
+	if err != nil {
+		s.abortMultipart(key, initiated.UploadId)
+	}
+	return err
+}
+
+func (s S3Target) abortMultipart(key string, uploadID string) {
+	_, err := s.do(http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil)
+	if err != nil {
+		fmt.Printf("Cannot abort multipart upload of [%s]: %s\n", key, err)
+	}
+}
+
+type s3Response struct {
+	Header http.Header
+	Body   []byte
+}
+
+// do sends signed request for the object. Path-style URLs are used, as supported by
+// both AWS and MinIO.
+func (s S3Target) do(method string, key string, query url.Values, body []byte) (s3Response, error) {
+	target, err := url.Parse(s.Endpoint)
+	if err != nil {
+		return s3Response{}, err
+	}
+	target.Path = "/" + s.Bucket + "/" + key
+	target.RawPath = awsURIEncode(target.Path, false)
+	target.RawQuery = awsCanonicalQuery(query)
+
+	req, err := http.NewRequest(method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return s3Response{}, err
+	}
+
+	digest := sha256.Sum256(body)
+	req.Header.Set(awsContentSHA256, hex.EncodeToString(digest[:]))
+	signV4(req, s.AccessKey, s.SecretKey, s.Region, "s3", time.Now())
+
+	resp, err := s3Client.Do(req)
+	if err != nil {
+		return s3Response{}, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return s3Response{}, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return s3Response{}, fmt.Errorf("HTTP %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	return s3Response{resp.Header, data}, nil
+}
+
+// signV4 adds Authorization header of AWS Signature Version 4. Host and all headers of
+// the request are signed. Hash of payload is taken from x-amz-content-sha256 header,
+// hash of empty body is used if header is not set.
+func signV4(req *http.Request, accessKey string, secretKey string, region string, service string, now time.Time) {
+	now = now.UTC()
+	req.Header.Set("X-Amz-Date", now.Format(awsTimeFormat))
+
+	payloadHash := req.Header.Get(awsContentSHA256)
+	if payloadHash == "" {
+		digest := sha256.Sum256(nil)
+		payloadHash = hex.EncodeToString(digest[:])
+	}
+
+	headers := map[string]string{"host": req.Host}
+	if req.Host == "" {
+		headers["host"] = req.URL.Host
+	}
+	for name, values := range req.Header {
+		trimmed := make([]string, len(values))
+		for i, value := range values {
+			trimmed[i] = strings.Join(strings.Fields(value), " ")
+		}
+		headers[strings.ToLower(name)] = strings.Join(trimmed, ",")
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	canonicalHeaders := new(strings.Builder)
+	for _, name := range names {
+		fmt.Fprintf(canonicalHeaders, "%s:%s\n", name, headers[name])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		awsURIEncode(firstNonEmpty(req.URL.Path, "/"), false),
+		awsCanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{now.Format(awsDateFormat), region, service, "aws4_request"}, "/")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{awsSigningAlgo, now.Format(awsTimeFormat), scope, hex.EncodeToString(requestHash[:])}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), now.Format(awsDateFormat))
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s", awsSigningAlgo, accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// awsURIEncode encodes everything except unreserved characters, as required by SigV4
+func awsURIEncode(value string, encodeSlash bool) string {
+	result := new(strings.Builder)
+	for _, b := range []byte(value) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9', b == '-', b == '_', b == '.', b == '~':
+			result.WriteByte(b)
+		case b == '/' && !encodeSlash:
+			result.WriteByte(b)
+		default:
+			fmt.Fprintf(result, "%%%02X", b)
+		}
+	}
+	return result.String()
+}
+
+func awsCanonicalQuery(query url.Values) string {
+	parts := []string{}
+	for name, values := range query {
+		for _, value := range values {
+			parts = append(parts, awsURIEncode(name, true)+"="+awsURIEncode(value, true))
+		}
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "&")
+}
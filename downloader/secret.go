@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	SecretSourceFile string = "file:"
+	SecretSourceEnv         = "env:"
+)
+
+// readSecret reads secret from first line of a file (file:<path>) or environment
+// variable (env:<name>), so that it does not appear in command line, shell history or
+// files shared with others. Used for password of connection file, -encrypt and -redact.
+func readSecret(source string) ([]byte, error) {
+	var secret string
+
+	switch {
+	case strings.HasPrefix(source, SecretSourceFile):
+		filename := strings.TrimPrefix(source, SecretSourceFile)
+		contents, err := os.ReadFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("Secret file [%s] not found", filename)
+		}
+		secret, _, _ = strings.Cut(string(contents), "\n")
+	case strings.HasPrefix(source, SecretSourceEnv):
+		secret = os.Getenv(strings.TrimPrefix(source, SecretSourceEnv))
+	default:
+		return nil, fmt.Errorf("Secret source [%s] is unknown. Use file:<path> or env:<variable>", source)
+	}
+
+	// trimmed like lines of connection file
+	secret = strings.TrimSpace(secret)
+	if secret == "" {
+		return nil, fmt.Errorf("Secret from [%s] is empty", source)
+	}
+	return []byte(secret), nil
+}
+
+// secretReference returns source of a value written as {file:<path>} or {env:<variable>}.
+// Braces tell the reference from a password which itself starts with file: or env:.
+func secretReference(value string) (string, bool) {
+	if !strings.HasPrefix(value, "{") || !strings.HasSuffix(value, "}") {
+		return "", false
+	}
+
+	source := value[1 : len(value)-1]
+	if strings.HasPrefix(source, SecretSourceFile) || strings.HasPrefix(source, SecretSourceEnv) {
+		return source, true
+	}
+	return "", false
+}
+
+// resolveSecret returns value as is, unless it refers to a file or environment
+// variable, see readSecret
+func resolveSecret(value string) ([]byte, error) {
+	if strings.HasPrefix(value, SecretSourceFile) || strings.HasPrefix(value, SecretSourceEnv) {
+		return readSecret(value)
+	}
+	return []byte(value), nil
+}
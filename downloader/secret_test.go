@@ -0,0 +1,91 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadSecret(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "key.txt")
+	os.WriteFile(filename, []byte("  from file \r\nsecond line\n"), 0o600)
+	t.Setenv("DOWNLOADER_TEST_KEY", "from env")
+
+	tests := []struct {
+		Index    string
+		Source   string
+		Expected string
+		Error    bool
+	}{
+		{"01", "file:" + filename, "from file", false},
+		{"02", "env:DOWNLOADER_TEST_KEY", "from env", false},
+		{"03", "env:DOWNLOADER_TEST_KEY_MISSING", "", true},
+		{"04", "file:" + filename + ".missing", "", true},
+		{"05", "secret", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Index, func(t *testing.T) {
+			secret, err := readSecret(test.Source)
+			t.Logf(`Secret: [%s], error: %v`, secret, err)
+
+			if string(secret) != test.Expected || (err != nil) != test.Error {
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestResolveSecret(t *testing.T) {
+	t.Setenv("DOWNLOADER_TEST_KEY", "from env")
+
+	tests := []struct {
+		Index    string
+		Value    string
+		Expected string
+		Error    bool
+	}{
+		{"01", "$ecretPassw0rd", "$ecretPassw0rd", false},
+		{"02", "env:DOWNLOADER_TEST_KEY", "from env", false},
+		{"03", "env:DOWNLOADER_TEST_KEY_MISSING", "", true},
+		{"04", "file:testdata/connection/15.password", "PASSWORD", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Index, func(t *testing.T) {
+			secret, err := resolveSecret(test.Value)
+			t.Logf(`Secret: [%s], error: %v`, secret, err)
+
+			if string(secret) != test.Expected || (err != nil) != test.Error {
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestSecretReference(t *testing.T) {
+	tests := []struct {
+		Index     string
+		Value     string
+		Source    string
+		Reference bool
+	}{
+		{"01", "{env:PO_PASSWORD}", "env:PO_PASSWORD", true},
+		{"02", "{file:C:\\keys\\po.txt}", "file:C:\\keys\\po.txt", true},
+		{"03", "env:PO_PASSWORD", "", false},
+		{"04", "file:secret", "", false},
+		{"05", "{$ecretPassw0rd}", "", false},
+		{"06", "{env:PO_PASSWORD", "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Index, func(t *testing.T) {
+			source, ok := secretReference(test.Value)
+			t.Logf(`Source: [%s], reference: %v`, source, ok)
+
+			if source != test.Source || ok != test.Reference {
+				t.Fail()
+			}
+		})
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"slices"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -17,12 +20,140 @@ type Statistics struct {
 	NetworkBytesDownloaded int64 // number of raw bytes (HTTP)
 	PayloadSize            int64 // number of raw bytes (payload except RAW)
 	DiskBytesWritten       int64 // number of resulting bytes (files after compression)
+	UnpackWarnings         int32 // number of problems found while parsing messages
+	DuplicateFiles         int32 // number of files not written because of -dedup
+	DuplicateBytesSaved    int64 // number of bytes not written because of -dedup
+	VersionsMatched        int32 // number of versions matched by -match
+	VersionsFilteredOut    int32 // number of versions not saved because of -match
+	VersionsNotDownloaded  int32 // number of versions skipped by -matchfirst
+	VersionsDownloadFailed int32 // number of versions not downloaded because of errors
+	FilesUploaded          int32 // number of files uploaded to -s3
+	FilesUploadFailed      int32 // number of files not uploaded to -s3 because of errors
+	BytesUploaded          int64 // number of bytes uploaded to -s3
 
 }
 
 var statistics Statistics
 
+// stageCounter measures throughput of one pipeline stage
+type stageCounter struct {
+	Name    string
+	Unit    string
+	Workers int32 // number of goroutines running the stage
+	Items   int64
+	Bytes   int64 // input bytes processed
+	Busy    int64 // nanoseconds spent processing, summed over goroutines
+}
+
+func (s *stageCounter) Add(bytes int, started time.Time) {
+	atomic.AddInt64(&s.Items, 1)
+	atomic.AddInt64(&s.Bytes, int64(bytes))
+	atomic.AddInt64(&s.Busy, int64(time.Since(started)))
+}
+
+var (
+	stageDownload = stageCounter{Name: "download", Unit: "versions"}
+	stageUnpack   = stageCounter{Name: "unpack", Unit: "versions"}
+	stageRedact   = stageCounter{Name: "redact", Unit: "versions"}
+	stageWrite    = stageCounter{Name: "write", Unit: "versions"}
+
+	statisticsStarted time.Time
+)
+
+// queue between pipeline stages, its length is shown while processing
+type watchedQueue struct {
+	name     string
+	length   func() int
+	capacity int
+}
+
+var watchedQueues []watchedQueue
+
+func watchQueue(name string, length func() int, capacity int) {
+	watchedQueues = append(watchedQueues, watchedQueue{name, length, capacity})
+}
+
+func queueStatus() string {
+	if len(watchedQueues) == 0 {
+		return ""
+	}
+
+	pieces := []string{}
+	for _, q := range watchedQueues {
+		pieces = append(pieces, fmt.Sprintf("%s %d/%d", q.name, q.length(), q.capacity))
+	}
+	return fmt.Sprintf(" (queues: %s)", strings.Join(pieces, ", "))
+}
+
+// thread-safe counter of named events (log versions, patterns, etc)
+type namedCounter struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (c *namedCounter) Add(name string, n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.counts == nil {
+		c.counts = make(map[string]int)
+	}
+	c.counts[name] += n
+}
+
+func (c *namedCounter) Get(name string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.counts[name]
+}
+
+func (c *namedCounter) Keys() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keys := make([]string, 0, len(c.counts))
+	for key := range c.counts {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// log version names reported by the server and -log patterns which matched any of them
+var logVersionsSeen, logPatternHits namedCounter
+
+func recordLogVersionHits(selection []string, available []string) {
+	for _, name := range available {
+		logVersionsSeen.Add(name, 1)
+	}
+
+	for _, pattern := range selection {
+		for _, name := range available {
+			if matchLogVersion(strings.TrimPrefix(pattern, LogVersionExcludePrefix), name) {
+				logPatternHits.Add(pattern, 1)
+				break
+			}
+		}
+	}
+}
+
+// -log entries which did not match a single log version of any message
+func unmatchedLogPatterns(selection []string) []string {
+	unmatched := []string{}
+	for _, pattern := range selection {
+		if pattern == LogVersionSpecialAll {
+			continue
+		}
+		if logPatternHits.Get(pattern) == 0 {
+			unmatched = append(unmatched, pattern)
+		}
+	}
+	return unmatched
+}
+
 func runStatistics() *time.Ticker {
+	statisticsStarted = time.Now()
 	statisticsTicker := time.NewTicker(time.Second)
 	go UpdateStatistics(statisticsTicker)
 	return statisticsTicker
@@ -31,14 +162,14 @@ func runStatistics() *time.Ticker {
 func UpdateStatistics(ticker *time.Ticker) {
 	for range ticker.C {
 		if statistics.MessagesFound > 0 {
-			fmt.Printf("Downloading messages... [%d / %d]\n", statistics.MessagesDownloaded, statistics.MessagesFound)
+			fmt.Printf("Downloading messages... [%d / %d]%s\n", statistics.MessagesDownloaded, statistics.MessagesFound, queueStatus())
 		} else {
 			fmt.Printf("Searching for messages by message IDs [%d IDs]...\n", statistics.MessagesInFile)
 		}
 	}
 }
 
-func showEndCredits() {
+func showEndCredits(options RuntimeConfiguration) {
 	// to ensure you see "[100 / 100]" messages done
 	fmt.Printf("Downloading messages... [%d / %d]\n", statistics.MessagesDownloaded, statistics.MessagesFound)
 	fmt.Println("--------------")
@@ -47,9 +178,79 @@ func showEndCredits() {
 	fmt.Printf("Processed messages    : %d / %d [%d Kb]\n", statistics.MessagesDownloaded, statistics.MessagesFound, statistics.NetworkBytesDownloaded/1024)
 	fmt.Printf("Payloads extracted    : %d [%d Kb]\n", statistics.PayloadsExtracted, statistics.PayloadSize/1024)
 	fmt.Printf("Files written to disk : %d [%d Kb]\n", statistics.FilesWrittenToDisk, statistics.DiskBytesWritten/1024)
+	if statistics.DuplicateFiles > 0 {
+		fmt.Printf("Duplicate files       : %d [%d Kb saved]\n", statistics.DuplicateFiles, statistics.DuplicateBytesSaved/1024)
+	}
+	if options.S3 != nil {
+		fmt.Printf("Files uploaded to S3  : %d [%d Kb], failed %d\n", statistics.FilesUploaded, statistics.BytesUploaded/1024, statistics.FilesUploadFailed)
+	}
+	if statistics.VersionsDownloadFailed > 0 {
+		fmt.Printf("Download errors       : %d versions (see messages above)\n", statistics.VersionsDownloadFailed)
+	}
+	if statistics.UnpackWarnings > 0 {
+		fmt.Printf("Unpacking problems    : %d (see messages above)\n", statistics.UnpackWarnings)
+	}
+	showStageStatistics()
+	showMatchStatistics(options.MatchPredicates)
+	showRedactionStatistics(options.RedactionRules)
+
+	unmatched := unmatchedLogPatterns(options.SaveLoggingVersions)
+	if len(unmatched) > 0 {
+		fmt.Println("--------------")
+		for _, pattern := range unmatched {
+			fmt.Printf("Warning: -log entry [%s] did not match log versions of any message\n", pattern)
+		}
+		fmt.Printf("Log versions seen on server: %s\n", strings.Join(logVersionsSeen.Keys(), ", "))
+	}
 }
 
-func generateStatistics(c <-chan XIAdapterMessage) {
+func showStageStatistics() {
+	fmt.Println("--------------")
+	if !statisticsStarted.IsZero() {
+		fmt.Printf("Elapsed time          : %s\n", time.Since(statisticsStarted).Round(time.Millisecond))
+	}
+	fmt.Println("Stage throughput (busy time is summed over parallel goroutines):")
+
+	for _, stage := range []*stageCounter{&stageDownload, &stageUnpack, &stageRedact, &stageWrite} {
+		if stage.Items == 0 {
+			continue
+		}
+
+		busy := time.Duration(stage.Busy)
+		rate := 0.0
+		if busy > 0 {
+			rate = float64(stage.Items) / busy.Seconds() * float64(max(stage.Workers, 1))
+		}
+		fmt.Printf("  %-9s: %d %s [%d Kb], %d goroutine(s), busy %s, %.1f %s/s\n",
+			stage.Name, stage.Items, stage.Unit, stage.Bytes/1024, stage.Workers, busy.Round(time.Millisecond), rate, stage.Unit)
+	}
+}
+
+func showMatchStatistics(predicates []ContentPredicate) {
+	if len(predicates) == 0 {
+		return
+	}
+
+	fmt.Println("--------------")
+	fmt.Printf("Content filter        : %d versions matched, %d filtered out, %d not downloaded\n", statistics.VersionsMatched, statistics.VersionsFilteredOut, statistics.VersionsNotDownloaded)
+	for _, predicate := range predicates {
+		fmt.Printf("  %s: %d hits in %d versions\n", predicate.Expression, matchHits.Get(predicate.Expression), matchVersions.Get(predicate.Expression))
+	}
+}
+
+func showRedactionStatistics(rules []RedactionRule) {
+	if len(rules) == 0 {
+		return
+	}
+
+	fmt.Println("--------------")
+	fmt.Println("Redacted values by rule:")
+	for _, rule := range rules {
+		fmt.Printf("  %-20s: %d\n", rule.Name, redactionHits.Get(rule.Name))
+	}
+}
+
+func generateStatistics(options RuntimeConfiguration, c <-chan XIAdapterMessage) {
 	// processor for -statsonly mode
 	stats := make(map[string]int)
 	keys := []string{}
@@ -57,6 +258,7 @@ func generateStatistics(c <-chan XIAdapterMessage) {
 	for msg := range c {
 
 		// LOG
+		recordLogVersionHits(options.SaveLoggingVersions, msg.LogLocations.String)
 		for _, log := range msg.LogLocations.String {
 			key := "LOG." + log
 			v, ok := stats[key]
@@ -91,4 +293,10 @@ func generateStatistics(c <-chan XIAdapterMessage) {
 		fmt.Printf("%30s:   %d\n", key, stats[key])
 	}
 	println(`------------------------------------------`)
+
+	// hint for -log option
+	fmt.Printf("Log version names seen on server (usable with -log): %s\n", strings.Join(logVersionsSeen.Keys(), ", "))
+	for _, pattern := range unmatchedLogPatterns(options.SaveLoggingVersions) {
+		fmt.Printf("Warning: -log entry [%s] does not match log versions of any message\n", pattern)
+	}
 }
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
 	"encoding/base64"
 	"encoding/xml"
@@ -11,43 +10,195 @@ import (
 	"mime"
 	"mime/multipart"
 	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 )
 
 type XIMessagePayloads struct {
-	MessageID string
-	VersionID string
-	Folder    string
-	Parts     []XIPayload
+	MessageID   string
+	VersionID   string
+	Folder      string
+	Message     XIAdapterMessage
+	Header      *XIHeader // nil if XI header cannot be parsed
+	Parts       []XIPayload
+	Diagnostics []string       // problems found while unpacking
+	Matches     map[string]int // hits of -match predicates
+	FilteredOut bool           // no -match predicate matched, version is not saved
+}
+
+// Size returns total size of all parts
+func (payloads *XIMessagePayloads) Size() int {
+	size := 0
+	for _, part := range payloads.Parts {
+		size += len(part.Contents)
+	}
+	return size
+}
+
+// newMessagePayloads returns empty result for the message version
+func newMessagePayloads(entry XIMessageVersion) XIMessagePayloads {
+	return XIMessagePayloads{
+		MessageID: entry.MessageInfo.MessageID,
+		VersionID: fmt.Sprintf("%s.%s", entry.VersionType, entry.MessageVersion),
+		Message:   entry.MessageInfo,
+	}
+}
+
+// Diagnose records and reports a problem with the message version
+func (payloads *XIMessagePayloads) Diagnose(format string, a ...any) {
+	text := fmt.Sprintf(format, a...)
+	payloads.Diagnostics = append(payloads.Diagnostics, text)
+	atomic.AddInt32(&statistics.UnpackWarnings, 1)
+
+	if !quietDiagnostics {
+		fmt.Printf("Message [%s] version [%s]: %s\n", payloads.MessageID, payloads.VersionID, text)
+	}
 }
 
 type XIPayload struct {
-	Filename string
-	Contents []byte
+	Filename    string
+	Extension   string // appended to Filename by processDuplicateFilenames
+	Name        string // name of the part before prefixes and layouts are applied
+	Kind        PayloadKind
+	ContentType string
+	Notes       []string // processing applied to contents, recorded in manifest
+	Contents    []byte
 }
 
+type PayloadKind string
+
+const (
+	PayloadKindPayload     PayloadKind = "payload"
+	PayloadKindRaw                     = "raw"
+	PayloadKindXIHeader                = "xiheader"
+	PayloadKindFormatted               = "formatted"
+	PayloadKindHeaderJSON              = "headerjson"
+	PayloadKindDiagnostics             = "diagnostics" // manifest row without file, see ExportManifest.AddVersion
+)
+
 type XIMessageVersion struct {
 	MessageInfo    XIAdapterMessage
 	VersionType    VersionType
 	MessageVersion string
 	Base64Contents string
+	RawContents    []byte // used instead of Base64Contents for local files, see runUnpack
+	MessageMatched bool   // message matched -match on the probe version (-matchfirst)
+	DownloadError  error  // version cannot be downloaded, reported as diagnostic
+
+	// set if version was already unpacked by downloader to probe -match
+	Unpacked *XIMessagePayloads
 }
 
 type VersionType string
 
 const (
-	VersionTypeLogged VersionType = "LOG"
-	VersionTypeStaged             = "STAGE"
+	VersionTypeLogged  VersionType = "LOG"
+	VersionTypeStaged              = "STAGE"
+	VersionTypeOffline             = "FILE" // local file without version in its path
 )
 
 const MultipartRelated string = "multipart/related"
 
+// diagnostics are not printed during fuzzing and tests
+var quietDiagnostics bool
+
+// Unpacker runs options.UnpackThreads goroutines. Results are passed to payloadChan
+// in the same order as versions were received.
 func Unpacker(options RuntimeConfiguration, versionChan <-chan XIMessageVersion, payloadChan chan<- XIMessagePayloads) {
 	defer wgUnpackers.Done()
 
-	for entry := range versionChan {
-		payloadChan <- UnpackPartsBase64(options, entry)
+	workers := max(options.UnpackThreads, 1)
+	atomic.AddInt32(&stageUnpack.Workers, int32(workers))
+
+	forward := func(payloads XIMessagePayloads) {
+		if payloads.FilteredOut {
+			atomic.AddInt32(&statistics.VersionsFilteredOut, 1)
+			return
+		}
+		payloadChan <- payloads
 	}
+
+	if workers == 1 {
+		for entry := range versionChan {
+			forward(unpackMeasured(options, entry))
+		}
+		return
+	}
+
+	type job struct {
+		sequence int
+		entry    XIMessageVersion
+	}
+	type result struct {
+		sequence int
+		payloads XIMessagePayloads
+	}
+
+	jobs := make(chan job, workers)
+	results := make(chan result, workers)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				results <- result{j.sequence, unpackMeasured(options, j.entry)}
+			}
+		}()
+	}
+
+	go func() {
+		sequence := 0
+		for entry := range versionChan {
+			jobs <- job{sequence, entry}
+			sequence++
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	// reorder results
+	pending := make(map[int]XIMessagePayloads)
+	next := 0
+	for r := range results {
+		pending[r.sequence] = r.payloads
+		for {
+			payloads, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			forward(payloads)
+			next++
+		}
+	}
+}
+
+func unpackMeasured(options RuntimeConfiguration, entry XIMessageVersion) XIMessagePayloads {
+	if entry.Unpacked != nil {
+		return *entry.Unpacked
+	}
+
+	started := time.Now()
+	payloads := unpackSafely(options, entry)
+	filterPayloads(options, entry, &payloads)
+	stageUnpack.Add(len(entry.Base64Contents)+len(entry.RawContents), started)
+	return payloads
+}
+
+// unpackSafely turns any unexpected failure while unpacking into a diagnostic of the message
+func unpackSafely(options RuntimeConfiguration, entry XIMessageVersion) (payloads XIMessagePayloads) {
+	defer func() {
+		if r := recover(); r != nil {
+			payloads = newMessagePayloads(entry)
+			payloads.Diagnose("internal error while unpacking, skipping: %v", r)
+		}
+	}()
+
+	return UnpackPartsBase64(options, entry)
 }
 
 func generateFilename(filename string) string {
@@ -64,11 +215,17 @@ func generateFilename(filename string) string {
 
 func generateFilenamePrefix(options RuntimeConfiguration, entry XIMessageVersion) (string, string) {
 
+	if options.OutputLayout != "" {
+		// folder does not depend on payload (see processLayoutFlag)
+		path, _ := expandLayout(options.OutputLayout, entry, "", 0, options.TimeZone)
+		return path, ""
+	}
+
 	pathtemplate := ""
 	filenameprefixtemplate := ""
 
 	switch options.GroupOutputBy {
-	// %[1]s:  MessageID
+	// %[1]s:  MessageID (entry name, see assignEntryNames)
 	// %[2]s:  VersionType
 	// %[3]s:  MessageVersion
 	case OutputGroupMessage:
@@ -98,21 +255,41 @@ func generateFilenamePrefix(options RuntimeConfiguration, entry XIMessageVersion
 
 	path, filenameprefix := "", ""
 	if pathtemplate != "" {
-		path = fmt.Sprintf(pathtemplate, entry.MessageInfo.MessageID, entry.VersionType, entry.MessageVersion)
+		path = fmt.Sprintf(pathtemplate, entryName(entry.MessageInfo), entry.VersionType, entry.MessageVersion)
 	}
 	if filenameprefixtemplate != "" {
-		filenameprefix = fmt.Sprintf(filenameprefixtemplate, entry.MessageInfo.MessageID, entry.VersionType, entry.MessageVersion)
+		filenameprefix = fmt.Sprintf(filenameprefixtemplate, entryName(entry.MessageInfo), entry.VersionType, entry.MessageVersion)
 	}
 
 	return path, filenameprefix
 
 }
 
+// generatePayloadFilename builds filename for a message part, index is a number of MIME part (1-based)
+func generatePayloadFilename(options RuntimeConfiguration, entry XIMessageVersion, filenameprefix string, partname string, index int) string {
+	if options.OutputLayout != "" {
+		_, filename := expandLayout(options.OutputLayout, entry, partname, index, options.TimeZone)
+		return filename
+	}
+
+	return generateFilename(filenameprefix + partname)
+}
+
 func UnpackPartsBase64(options RuntimeConfiguration, entry XIMessageVersion) XIMessagePayloads {
+	if entry.DownloadError != nil {
+		payloads := newMessagePayloads(entry)
+		payloads.Diagnose("cannot download version: %s", entry.DownloadError)
+		return payloads
+	}
+	if entry.RawContents != nil {
+		return UnpackParts(options, entry, entry.RawContents)
+	}
+
 	data, err := base64.StdEncoding.DecodeString(entry.Base64Contents)
 	if err != nil {
-		fmt.Printf("Error unpacking base64 contents for Message Key [%s], skipping...\n", entry.MessageInfo.MessageKey)
-		return XIMessagePayloads{}
+		payloads := newMessagePayloads(entry)
+		payloads.Diagnose("cannot decode base64 contents, skipping: %s", err)
+		return payloads
 	}
 	return UnpackParts(options, entry, data)
 }
@@ -121,15 +298,15 @@ func UnpackParts(options RuntimeConfiguration, entry XIMessageVersion, data []by
 
 	path, filenameprefix := generateFilenamePrefix(options, entry)
 
-	payloads := XIMessagePayloads{}
-	payloads.MessageID = entry.MessageInfo.MessageID
-	payloads.VersionID = fmt.Sprintf("%s.%s", entry.VersionType, entry.MessageVersion)
+	payloads := newMessagePayloads(entry)
 	payloads.Folder = path
 
 	if options.SaveRawContent {
 
 		payloads.Parts = append(payloads.Parts, XIPayload{
-			Filename: generateFilename(filenameprefix + "RAW"),
+			Filename: generatePayloadFilename(options, entry, filenameprefix, "RAW", 0),
+			Name:     "RAW",
+			Kind:     PayloadKindRaw,
 			Contents: bytes.Clone(data), // copy of bytes since we are making adjustments later on
 		})
 
@@ -138,86 +315,125 @@ func UnpackParts(options RuntimeConfiguration, entry XIMessageVersion, data []by
 		// atomic.AddInt32(&statistics.PayloadsExtracted, 1)
 	}
 
-	// fix for SAP mistake in mime/multipart
-	data = bytes.Replace(data, []byte("\n\r"), []byte("\r\n"), 1)
-
-	////
-	bufReader := bytes.NewReader(data)
-	reader := bufio.NewReader(bufReader)
-	headerAttributes := make(map[string]string)
-	// only single-line header declarations are supported for now
-	for {
-		line, _ := reader.ReadString('\n')
-		line = strings.TrimSpace(line)
-		if len(line) == 0 {
-			break
-		}
-		parts := strings.SplitN(string(line), ":", 2)
-		key := strings.ToLower(parts[0])
-		value := parts[1]
-
-		headerAttributes[key] = value
+	headers, body, diagnostics := parseMessageHeaders(data)
+	for _, d := range diagnostics {
+		payloads.Diagnose("message headers: %s", d)
 	}
 
-	val, ok := headerAttributes["content-type"]
-	if !ok {
-		fmt.Printf("Cannot decode payload for [%s], no content-type attribute, skipping...\n", entry.MessageInfo.MessageID)
+	val := headers.Get("Content-Type")
+	if val == "" {
+		payloads.Diagnose("cannot decode payload, no content-type attribute, skipping")
 		return payloads
 	}
 
-	mediatype, params, _ := mime.ParseMediaType(val)
+	mediatype, params, err := mime.ParseMediaType(val)
+	if err != nil && mediatype == "" {
+		payloads.Diagnose("cannot parse content-type [%s]: %s, skipping", val, err)
+		return payloads
+	}
 	if !strings.HasPrefix(mediatype, MultipartRelated) {
-		fmt.Printf("Unsupported content-type for [%s] = [%s], should be [%s]. Skipping...\n", entry.MessageInfo.MessageID, mediatype, MultipartRelated)
+		payloads.Diagnose("unsupported content-type [%s], should be [%s], skipping", mediatype, MultipartRelated)
 		return payloads
 	}
+	if params["boundary"] == "" {
+		payloads.Diagnose("content-type has no boundary, skipping")
+		return payloads
+	}
+
+	body, diagnostics = normalizeMultipartHeaders(body, params["boundary"])
+	for _, d := range diagnostics {
+		payloads.Diagnose("multipart: %s", d)
+	}
 
-	mr := multipart.NewReader(reader, params["boundary"])
+	mr := multipart.NewReader(bytes.NewReader(body), params["boundary"])
 	xiHeaderContentID := params["start"]
-	xiMessageHeader := XIManifest{}
+	xiMessageHeader := XIHeader{}
 
-	for {
-		p, err := mr.NextPart()
+	for partIndex := 1; ; partIndex++ {
+		// raw part keeps Content-Transfer-Encoding untouched, it is handled below
+		p, err := mr.NextRawPart()
 		if errors.Is(err, io.EOF) {
 			break
 		}
 		if err != nil {
-			fmt.Printf("Error at NextPart [%s]. skipping....\n", err)
+			payloads.Diagnose("cannot read part %d: %s, skipping rest of the message", partIndex, err)
 			break
 		}
 
 		partData, err := io.ReadAll(p)
 		if err != nil {
-			fmt.Printf("Error reading Part [%s]. skipping....\n", err)
+			payloads.Diagnose("cannot read part %d: %s, skipping rest of the message", partIndex, err)
 			break
 		}
 
 		partContentID := p.Header.Get("Content-Id")
 		partContentType := p.Header.Get("Content-Type")
 		partFilename := p.FileName()
+		partKind := PayloadKindPayload
+		partNotes := []string{}
 
-		if partContentID == xiHeaderContentID {
-			xiMessageHeader = processXIHeader(partData)
+		partEncoding := p.Header.Get("Content-Transfer-Encoding")
+		partDecoded, decoded, err := decodeTransferEncoding(partEncoding, partData)
+		if err != nil {
+			payloads.Diagnose("cannot decode part %d with transfer encoding [%s], saved as-is: %s", partIndex, partEncoding, err)
+		}
+		if decoded {
+			if options.KeepTransferEncoding {
+				partNotes = append(partNotes, fmt.Sprintf("encoded:%s", strings.ToLower(partEncoding)))
+			} else {
+				partData = partDecoded
+				partNotes = append(partNotes, fmt.Sprintf("decoded:%s", strings.ToLower(partEncoding)))
+			}
+		}
+
+		if partContentID == xiHeaderContentID || (xiHeaderContentID == "" && partIndex == 1) {
+			xiMessageHeader, err = processXIHeader(partDecoded)
+			if err != nil {
+				payloads.Diagnose("cannot process XI header: %s", err)
+			} else {
+				payloads.Header = &xiMessageHeader
+			}
+
+			if options.SaveHeaderJSON && payloads.Header != nil {
+				headerJSON, err := payloads.Header.JSON()
+				if err != nil {
+					payloads.Diagnose("cannot convert XI header to JSON: %s", err)
+				} else {
+					payloads.Parts = append(payloads.Parts, XIPayload{
+						Filename:    generatePayloadFilename(options, entry, filenameprefix, XIHeaderJSONFilename, partIndex),
+						Name:        XIHeaderJSONFilename,
+						Kind:        PayloadKindHeaderJSON,
+						ContentType: "application/json",
+						Contents:    headerJSON,
+					})
+				}
+			}
 			if options.SaveXIHeader == false {
 				// skipping header
 				continue
 			}
 
 			partFilename = "XIHEADER.xml" // constant name
+			partKind = PayloadKindXIHeader
 		}
 
 		if partFilename == "" {
 			partFilename = getPartNameByContentID(xiMessageHeader, partContentID, partContentType)
 		}
 
-		filename := generateFilename(filenameprefix + partFilename)
+		filename := generatePayloadFilename(options, entry, filenameprefix, partFilename, partIndex)
 		if filename == "" {
-			fmt.Printf("Cannot generate filename for [%s], skipping...\n", entry.MessageInfo.MessageID)
+			payloads.Diagnose("cannot generate filename for part %d, skipping", partIndex)
 			continue
 		}
 
 		payloadPart := XIPayload{
-			Filename: filename,
-			Contents: partData,
+			Filename:    filename,
+			Name:        partFilename,
+			Kind:        partKind,
+			ContentType: partContentType,
+			Notes:       partNotes,
+			Contents:    partData,
 		}
 
 		payloads.Parts = append(payloads.Parts, payloadPart)
@@ -226,27 +442,48 @@ func UnpackParts(options RuntimeConfiguration, entry XIMessageVersion, data []by
 		atomic.AddInt64(&statistics.PayloadSize, int64(len(partData)))
 	}
 
+	if options.UnzipArchives {
+		unpackArchives(options, &payloads)
+	}
+
+	if options.ConvertToUTF8 {
+		convertCharsets(&payloads)
+	}
+
+	if options.EmbeddedAuto || len(options.EmbeddedRules) > 0 {
+		extractEmbedded(options, &payloads)
+	}
+
+	if options.InferExtensions {
+		inferExtensions(&payloads)
+	}
+
+	if options.FormatMode != PayloadFormatNone && options.FormatMode != "" {
+		formatPayloads(options, &payloads)
+	}
+
 	processDuplicateFilenames(&payloads)
 	return payloads
 }
 
-func processXIHeader(content []byte) XIManifest {
+func processXIHeader(content []byte) (XIHeader, error) {
 	result := new(XIEnvelop)
 	err := xml.Unmarshal(content, &result)
 	if err != nil {
-		fmt.Printf(`cannot process XI header, need revision`)
-		return XIManifest{}
+		return XIHeader{}, err
 	}
 
-	return result.Body.Manifest
+	header := result.Header
+	header.Manifest = result.Body.Manifest.Payload
+	return header, nil
 }
 
-func getPartNameByContentID(xiMessageHeader XIManifest, contentID string, contentType string) string {
+func getPartNameByContentID(xiMessageHeader XIHeader, contentID string, contentType string) string {
 
 	contentID = "cid:" + strings.Trim(contentID, "<>")
 	probableName := ""
 
-	for _, payload := range xiMessageHeader.Payload {
+	for _, payload := range xiMessageHeader.Manifest {
 		if payload.Href != contentID {
 			continue
 		}
@@ -274,6 +511,7 @@ func processDuplicateFilenames(payloads *XIMessagePayloads) {
 
 	for i, _ := range payloads.Parts {
 		name := payloads.Parts[i].Filename
+		ext := payloads.Parts[i].Extension
 		postfix := 1
 		newname := name
 
@@ -282,6 +520,8 @@ func processDuplicateFilenames(payloads *XIMessagePayloads) {
 			if postfix > 1 {
 				newname = fmt.Sprintf("%s_%d", newname, postfix)
 			}
+			// suffix goes before extension so files can still be opened
+			newname += ext
 
 			_, found := names[newname]
 			if !found {
@@ -292,6 +532,7 @@ func processDuplicateFilenames(payloads *XIMessagePayloads) {
 			}
 		}
 
+		payloads.Parts[i].Extension = ""
 		if name != newname {
 			payloads.Parts[i].Filename = newname
 		}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync/atomic"
+)
+
+// folder suffix for extracted entries, e.g. MainDocument.unzip/orders/1.xml
+const ArchiveFolderSuffix string = ".unzip"
+
+var errArchiveTooLarge = errors.New("size limit exceeded")
+
+// archiveBudget limits total size of contents extracted from one part
+type archiveBudget struct {
+	remaining int64
+}
+
+func (b *archiveBudget) read(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, b.remaining+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > b.remaining {
+		return nil, errArchiveTooLarge
+	}
+	b.remaining -= int64(len(data))
+	return data, nil
+}
+
+// unpackArchives extracts entries of ZIP and GZIP parts (e.g. created by PayloadZipBean)
+// as additional payloads. Original parts are kept.
+func unpackArchives(options RuntimeConfiguration, payloads *XIMessagePayloads) {
+	extracted := []XIPayload{}
+
+	for _, part := range payloads.Parts {
+		if part.Kind != PayloadKindPayload {
+			continue
+		}
+
+		budget := &archiveBudget{remaining: int64(options.UnzipMaxSize)}
+		extracted = append(extracted, extractArchive(options, payloads, part, 1, budget)...)
+	}
+
+	for _, part := range extracted {
+		atomic.AddInt32(&statistics.PayloadsExtracted, 1)
+		atomic.AddInt64(&statistics.PayloadSize, int64(len(part.Contents)))
+	}
+
+	payloads.Parts = append(payloads.Parts, extracted...)
+}
+
+func extractArchive(options RuntimeConfiguration, payloads *XIMessagePayloads, part XIPayload, depth int, budget *archiveBudget) []XIPayload {
+	ext, _ := inferExtension(part.ContentType, part.Contents)
+	if ext != ".zip" && ext != ".gz" {
+		return nil
+	}
+
+	if depth > options.UnzipDepth {
+		payloads.Diagnose("archive [%s] is nested deeper than %d levels, not extracted", part.Name, options.UnzipDepth)
+		return nil
+	}
+
+	entries := []XIPayload{}
+	add := func(name string, kind string, data []byte) {
+		entryPath, ok := archiveEntryPath(name)
+		if !ok {
+			payloads.Diagnose("archive [%s] entry [%s] has unsafe path, skipped", part.Name, name)
+			return
+		}
+
+		entry := XIPayload{
+			Filename: part.Filename + ArchiveFolderSuffix + "/" + entryPath,
+			Name:     part.Name + ArchiveFolderSuffix + "/" + entryPath,
+			Kind:     PayloadKindPayload,
+			Notes:    []string{fmt.Sprintf("extracted:%s from %s", kind, part.Name)},
+			Contents: data,
+		}
+		entries = append(entries, entry)
+		entries = append(entries, extractArchive(options, payloads, entry, depth+1, budget)...)
+	}
+
+	switch ext {
+	case ".zip":
+		reader, err := zip.NewReader(bytes.NewReader(part.Contents), int64(len(part.Contents)))
+		if err != nil {
+			payloads.Diagnose("cannot open ZIP archive [%s]: %s", part.Name, err)
+			return nil
+		}
+
+		for _, file := range reader.File {
+			if file.FileInfo().IsDir() {
+				continue
+			}
+
+			rc, err := file.Open()
+			if err != nil {
+				payloads.Diagnose("cannot extract [%s] from ZIP archive [%s]: %s", file.Name, part.Name, err)
+				continue
+			}
+			data, err := budget.read(rc)
+			rc.Close()
+
+			if errors.Is(err, errArchiveTooLarge) {
+				payloads.Diagnose("archive [%s] exceeds size limit of %d bytes, extraction stopped", part.Name, options.UnzipMaxSize)
+				break
+			}
+			if err != nil {
+				payloads.Diagnose("cannot extract [%s] from ZIP archive [%s]: %s", file.Name, part.Name, err)
+				continue
+			}
+
+			add(file.Name, "zip", data)
+		}
+
+	case ".gz":
+		reader, err := gzip.NewReader(bytes.NewReader(part.Contents))
+		if err != nil {
+			payloads.Diagnose("cannot open GZIP archive [%s]: %s", part.Name, err)
+			return nil
+		}
+		defer reader.Close()
+
+		data, err := budget.read(reader)
+		if errors.Is(err, errArchiveTooLarge) {
+			payloads.Diagnose("archive [%s] exceeds size limit of %d bytes, not extracted", part.Name, options.UnzipMaxSize)
+			return nil
+		}
+		if err != nil {
+			payloads.Diagnose("cannot extract GZIP archive [%s]: %s", part.Name, err)
+			return nil
+		}
+
+		// original name is optional in GZIP header
+		name := reader.Name
+		if name == "" {
+			name = strings.TrimSuffix(path.Base(part.Name), ".gz")
+		}
+		add(name, "gzip", data)
+	}
+
+	return entries
+}
+
+// archiveEntryPath cleans path of the archive entry. Absolute paths are made relative,
+// paths leaving the target folder (zip slip) are rejected.
+func archiveEntryPath(name string) (string, bool) {
+	segments := []string{}
+
+	for _, segment := range strings.Split(strings.ReplaceAll(name, `\`, "/"), "/") {
+		switch segment {
+		case "", ".":
+			continue
+		case "..":
+			return "", false
+		}
+		segments = append(segments, generateFilename(segment))
+	}
+
+	if len(segments) == 0 {
+		return "", false
+	}
+	return strings.Join(segments, "/"), true
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"slices"
+	"testing"
+)
+
+func TestUnpackArchives(t *testing.T) {
+	quietDiagnostics = true
+	defer func() { quietDiagnostics = false }()
+
+	inner := testZip(t, map[string]string{"a.txt": "inner"})
+	outer := testZip(t, map[string]string{
+		"orders/1.xml":  "<a/>",
+		"../evil.txt":   "evil",
+		"/abs/x.txt":    "abs",
+		"nested/in.zip": string(inner),
+	})
+
+	gz := new(bytes.Buffer)
+	w := gzip.NewWriter(gz)
+	w.Name = "report.csv"
+	w.Write([]byte("a;b\n1;2\n"))
+	w.Close()
+
+	tests := []struct {
+		Index       string
+		Part        XIPayload
+		Depth       int
+		MaxSize     int64
+		Names       []string
+		Diagnostics int
+	}{
+		{"01", XIPayload{Name: "MainDocument", ContentType: "application/zip", Contents: outer}, 3, 1024,
+			[]string{"MainDocument.unzip/abs/x.txt", "MainDocument.unzip/nested/in.zip", "MainDocument.unzip/nested/in.zip.unzip/a.txt", "MainDocument.unzip/orders/1.xml"}, 1},
+		{"02", XIPayload{Name: "MainDocument", ContentType: "application/zip", Contents: outer}, 1, 1024,
+			[]string{"MainDocument.unzip/abs/x.txt", "MainDocument.unzip/nested/in.zip", "MainDocument.unzip/orders/1.xml"}, 2},
+		{"03", XIPayload{Name: "MainDocument", ContentType: "application/zip", Contents: outer}, 3, 8,
+			[]string{"MainDocument.unzip/abs/x.txt"}, 2},
+		{"04", XIPayload{Name: "data.gz", Contents: gz.Bytes()}, 3, 1024,
+			[]string{"data.gz.unzip/report.csv"}, 0},
+		{"05", XIPayload{Name: "MainDocument", ContentType: "application/zip", Contents: []byte("PK\x03\x04broken")}, 3, 1024,
+			[]string{}, 1},
+		{"06", XIPayload{Name: "MainDocument", ContentType: "application/xml", Contents: []byte("<a/>")}, 3, 1024,
+			[]string{}, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Index, func(t *testing.T) {
+			test.Part.Kind = PayloadKindPayload
+			test.Part.Filename = "prefix." + test.Part.Name
+			payloads := XIMessagePayloads{Parts: []XIPayload{test.Part}}
+
+			unpackArchives(RuntimeConfiguration{UnzipDepth: test.Depth, UnzipMaxSize: test.MaxSize}, &payloads)
+
+			names := []string{}
+			for _, part := range payloads.Parts[1:] {
+				names = append(names, part.Name)
+				if part.Filename != "prefix."+part.Name {
+					t.Errorf(`Unexpected filename [%s]`, part.Filename)
+				}
+			}
+			slices.Sort(names)
+			t.Logf(`Names      : %#v`, names)
+			t.Logf(`Diagnostics: %#v`, payloads.Diagnostics)
+
+			if !slices.Equal(names, test.Names) || len(payloads.Diagnostics) != test.Diagnostics {
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestArchiveEntryPath(t *testing.T) {
+	tests := []struct {
+		Input    string
+		Expected string
+		OK       bool
+	}{
+		{"a/b.xml", "a/b.xml", true},
+		{"/a//./b.xml", "a/b.xml", true},
+		{`C:\temp\b.xml`, "C_/temp/b.xml", true},
+		{"a/../../b.xml", "", false},
+		{"./", "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Input, func(t *testing.T) {
+			result, ok := archiveEntryPath(test.Input)
+			if result != test.Expected || ok != test.OK {
+				t.Errorf(`Got [%s] %v`, result, ok)
+			}
+		})
+	}
+}
+
+func testZip(t *testing.T, files map[string]string) []byte {
+	buffer := new(bytes.Buffer)
+	w := zip.NewWriter(buffer)
+
+	names := []string{}
+	for name := range files {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(files[name]))
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
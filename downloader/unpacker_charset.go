@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"regexp"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/encoding/unicode"
+)
+
+var xmlDeclarationRegexp = regexp.MustCompile(`^\s*<\?xml\s[^>]*?\bencoding\s*=\s*["']([A-Za-z0-9._:-]+)["']`)
+
+// convertCharsets transcodes text payloads to UTF-8. Source character set is taken from
+// byte order mark, charset parameter of Content-Type or XML declaration (in this order).
+// Parts without any of these are left as-is.
+func convertCharsets(payloads *XIMessagePayloads) {
+	for i := range payloads.Parts {
+		part := &payloads.Parts[i]
+		if part.Kind != PayloadKindPayload {
+			continue
+		}
+
+		charset, enc, err := detectCharset(part.ContentType, part.Contents)
+		if err != nil {
+			part.Notes = append(part.Notes, fmt.Sprintf("not converted: %s", err))
+			continue
+		}
+		if enc == nil {
+			continue
+		}
+
+		converted, err := enc.NewDecoder().Bytes(part.Contents)
+		if err != nil {
+			part.Notes = append(part.Notes, fmt.Sprintf("not converted: %s", err))
+			continue
+		}
+
+		part.Contents = replaceXMLEncoding(converted)
+		part.ContentType = replaceContentTypeCharset(part.ContentType)
+		part.Notes = append(part.Notes, fmt.Sprintf("converted:%s", charset))
+	}
+}
+
+// detectCharset returns name of the character set and decoder for it. Encoding is nil
+// if contents are UTF-8 already or character set is unknown.
+func detectCharset(contentType string, data []byte) (string, encoding.Encoding, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte("\xef\xbb\xbf")):
+		return "", nil, nil
+	case bytes.HasPrefix(data, []byte("\xff\xfe")):
+		return "utf-16le", unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM), nil
+	case bytes.HasPrefix(data, []byte("\xfe\xff")):
+		return "utf-16be", unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM), nil
+	}
+
+	charset := ""
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		charset = params["charset"]
+	}
+
+	if charset == "" {
+		switch {
+		// XML without byte order mark starts with "<?" or at least "<"
+		case bytes.HasPrefix(data, []byte("<\x00")):
+			charset = "utf-16le"
+		case bytes.HasPrefix(data, []byte("\x00<")):
+			charset = "utf-16be"
+		default:
+			if match := xmlDeclarationRegexp.FindSubmatch(prefix(data, 256)); match != nil {
+				charset = string(match[1])
+			}
+		}
+	}
+
+	charset = strings.ToLower(strings.Trim(strings.TrimSpace(charset), `"'`))
+	switch charset {
+	case "", "utf-8", "utf8", "us-ascii", "ascii":
+		return "", nil, nil
+	}
+
+	enc, err := ianaindex.IANA.Encoding(charset)
+	if err != nil || enc == nil {
+		enc, err = htmlindex.Get(charset)
+	}
+	if err != nil || enc == nil {
+		return charset, nil, fmt.Errorf("unknown charset [%s]", charset)
+	}
+
+	return charset, enc, nil
+}
+
+// replaceXMLEncoding changes encoding in XML declaration to UTF-8
+func replaceXMLEncoding(data []byte) []byte {
+	match := xmlDeclarationRegexp.FindSubmatchIndex(prefix(data, 256))
+	if match == nil {
+		return data
+	}
+
+	result := make([]byte, 0, len(data))
+	result = append(result, data[:match[2]]...)
+	result = append(result, "UTF-8"...)
+	result = append(result, data[match[3]:]...)
+	return result
+}
+
+func replaceContentTypeCharset(contentType string) string {
+	mediatype, params, err := mime.ParseMediaType(contentType)
+	if err != nil || params["charset"] == "" {
+		return contentType
+	}
+
+	params["charset"] = "utf-8"
+	return mime.FormatMediaType(mediatype, params)
+}
+
+func prefix(data []byte, limit int) []byte {
+	if len(data) > limit {
+		return data[:limit]
+	}
+	return data
+}
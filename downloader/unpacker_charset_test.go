@@ -0,0 +1,40 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestConvertCharsets(t *testing.T) {
+	tests := []struct {
+		Index       string
+		ContentType string
+		Input       string
+		Expected    string
+		ExpectedCT  string
+		Notes       []string
+	}{
+		{"01", "text/plain; charset=iso-8859-1", "St\xfcck", "Stück", "text/plain; charset=utf-8", []string{"converted:iso-8859-1"}},
+		{"02", "application/xml", "<?xml version=\"1.0\" encoding=\"windows-1251\"?><a>\xcf\xf0\xe8\xe2\xe5\xf2</a>", "<?xml version=\"1.0\" encoding=\"UTF-8\"?><a>Привет</a>", "application/xml", []string{"converted:windows-1251"}},
+		{"03", "", "\xff\xfe<\x00a\x00/\x00>\x00", "<a/>", "", []string{"converted:utf-16le"}},
+		{"04", "", "\x00<\x00a\x00/\x00>", "<a/>", "", []string{"converted:utf-16be"}},
+		{"05", "text/xml; charset=UTF-8", "<?xml version='1.0' encoding='UTF-8'?><a>Stück</a>", "<?xml version='1.0' encoding='UTF-8'?><a>Stück</a>", "text/xml; charset=UTF-8", nil},
+		{"06", "application/octet-stream", "%PDF-1.4 \xe2\xe3\xcf\xd3", "%PDF-1.4 \xe2\xe3\xcf\xd3", "application/octet-stream", nil},
+		{"07", "text/plain; charset=x-unknown", "St\xfcck", "St\xfcck", "text/plain; charset=x-unknown", []string{"not converted: unknown charset [x-unknown]"}},
+		{"08", "text/plain; charset=\"latin1\"", "\xe9t\xe9", "été", "text/plain; charset=utf-8", []string{"converted:latin1"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Index, func(t *testing.T) {
+			payloads := XIMessagePayloads{Parts: []XIPayload{{Kind: PayloadKindPayload, ContentType: test.ContentType, Contents: []byte(test.Input)}}}
+			convertCharsets(&payloads)
+
+			part := payloads.Parts[0]
+			t.Logf(`Result: %q, content type: %q, notes: %#v`, part.Contents, part.ContentType, part.Notes)
+
+			if string(part.Contents) != test.Expected || part.ContentType != test.ExpectedCT || !slices.Equal(part.Notes, test.Notes) {
+				t.Fail()
+			}
+		})
+	}
+}
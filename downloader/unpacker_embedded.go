@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync/atomic"
+)
+
+// EmbeddedAuto enables heuristic detection of base64 contents in -embedded
+const EmbeddedAuto string = "auto"
+
+// minimal length of base64 text considered by heuristic detection
+const embeddedAutoMinLength int = 64
+
+var base64TextRegexp = regexp.MustCompile(`^[A-Za-z0-9+/\s]+={0,2}\s*$`)
+
+// binary formats recognized by heuristic detection, text formats give too many false positives
+var embeddedAutoExtensions = []string{".pdf", ".zip", ".gz", ".png", ".jpg", ".gif", ".tif"}
+
+var (
+	embeddedAutoXMLPath  = PayloadPath{Expression: "//*", xmlSteps: []xmlPathStep{{name: "*", descendant: true}}}
+	embeddedAutoJSONPath = PayloadPath{Expression: "$..*", jsonSteps: []jsonPathStep{{any: true, descendant: true}}}
+)
+
+// extractEmbedded decodes base64 contents found in XML and JSON payloads by path rules
+// (or heuristics) and saves it as separate payloads next to the original one
+func extractEmbedded(options RuntimeConfiguration, payloads *XIMessagePayloads) {
+	extracted := []XIPayload{}
+
+	for _, part := range payloads.Parts {
+		if part.Kind != PayloadKindPayload {
+			continue
+		}
+
+		ext, _ := inferExtension(part.ContentType, part.Contents)
+		if ext != ".xml" && ext != ".json" {
+			continue
+		}
+
+		rules := []PayloadPath{}
+		for _, rule := range options.EmbeddedRules {
+			if rule.IsJSON() == (ext == ".json") {
+				rules = append(rules, rule)
+			}
+		}
+		auto := options.EmbeddedAuto && len(rules) == 0
+		if auto {
+			rules = []PayloadPath{embeddedAutoXMLPath}
+			if ext == ".json" {
+				rules = []PayloadPath{embeddedAutoJSONPath}
+			}
+		}
+
+		count := 0
+		seen := make(map[int64]bool)
+
+		for _, rule := range rules {
+			matches, err := rule.Find(part.Contents)
+			if err != nil {
+				payloads.Diagnose("cannot search embedded contents in [%s]: %s", part.Name, err)
+				break
+			}
+
+			for _, match := range matches {
+				if seen[match.Start] || strings.TrimSpace(match.Value) == "" {
+					continue
+				}
+				if auto && !base64TextRegexp.MatchString(match.Value) {
+					continue
+				}
+
+				data, decoded, err := decodeTransferEncoding(TransferEncodingBase64, []byte(match.Value))
+				if err != nil || !decoded {
+					if !auto {
+						payloads.Diagnose("value of [%s] in [%s] is not base64, skipped", match.Path, part.Name)
+					}
+					continue
+				}
+
+				ext := sniffExtension(data)
+				if auto && (len(strings.Join(strings.Fields(match.Value), "")) < embeddedAutoMinLength || !slices.Contains(embeddedAutoExtensions, ext)) {
+					continue
+				}
+				if ext == "" {
+					ext = ".bin"
+				}
+
+				seen[match.Start] = true
+				count++
+
+				name := fmt.Sprintf(".%s.%d", generateFilename(match.Name), count)
+				embedded := XIPayload{
+					Filename:  part.Filename + name,
+					Extension: ext,
+					Name:      part.Name + name,
+					Kind:      PayloadKindPayload,
+					Notes:     []string{fmt.Sprintf("embedded:base64 from %s at %s", part.Name, match.Path)},
+					Contents:  data,
+				}
+				extracted = append(extracted, embedded)
+
+				if options.UnzipArchives {
+					budget := &archiveBudget{remaining: options.UnzipMaxSize}
+					extracted = append(extracted, extractArchive(options, payloads, embedded, 1, budget)...)
+				}
+			}
+		}
+	}
+
+	for _, part := range extracted {
+		atomic.AddInt32(&statistics.PayloadsExtracted, 1)
+		atomic.AddInt64(&statistics.PayloadSize, int64(len(part.Contents)))
+	}
+
+	payloads.Parts = append(payloads.Parts, extracted...)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/base64"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestExtractEmbedded(t *testing.T) {
+	quietDiagnostics = true
+	defer func() { quietDiagnostics = false }()
+
+	pdf := "%PDF-1.4\n" + strings.Repeat("embedded invoice ", 10)
+	encoded := base64.StdEncoding.EncodeToString([]byte(pdf))
+	wrapped := encoded[:40] + "\n" + encoded[40:]
+
+	xmlPayload := `<Invoice><Attachment><ContentData>` + wrapped + `</ContentData></Attachment><Comment>SGVsbG8=</Comment><Code>ABCD</Code><Remark>not base64!</Remark></Invoice>`
+	jsonPayload := `{"attachments": [{"content": "` + encoded + `"}, {"content": "SGVsbG8="}]}`
+
+	tests := []struct {
+		Index       string
+		Rules       []string
+		Auto        bool
+		Payload     string
+		Names       []string
+		Diagnostics int
+	}{
+		{"01", []string{"//ContentData"}, false, xmlPayload, []string{"MainDocument.ContentData.1.pdf"}, 0},
+		{"02", []string{"//Comment", "//Code"}, false, xmlPayload, []string{"MainDocument.Comment.1.bin", "MainDocument.Code.2.bin"}, 0},
+		{"03", nil, true, xmlPayload, []string{"MainDocument.ContentData.1.pdf"}, 0},
+		{"04", []string{"$.attachments[*].content"}, false, jsonPayload, []string{"MainDocument.content.1.pdf", "MainDocument.content.2.bin"}, 0},
+		{"05", nil, true, jsonPayload, []string{"MainDocument.content.1.pdf"}, 0},
+		{"06", []string{"//Remark", "//Invoice"}, false, xmlPayload, []string(nil), 1},
+		{"07", []string{"$.attachments"}, false, xmlPayload, []string(nil), 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Index, func(t *testing.T) {
+			options := RuntimeConfiguration{EmbeddedAuto: test.Auto}
+			for _, rule := range test.Rules {
+				path, err := parsePayloadPath(rule)
+				if err != nil {
+					t.Fatal(err)
+				}
+				options.EmbeddedRules = append(options.EmbeddedRules, path)
+			}
+
+			payloads := XIMessagePayloads{Parts: []XIPayload{{Filename: "MainDocument", Name: "MainDocument", Kind: PayloadKindPayload, Contents: []byte(test.Payload)}}}
+			extractEmbedded(options, &payloads)
+			processDuplicateFilenames(&payloads)
+
+			var names []string
+			for _, part := range payloads.Parts[1:] {
+				names = append(names, part.Filename)
+			}
+			t.Logf(`Names      : %#v`, names)
+			t.Logf(`Diagnostics: %#v`, payloads.Diagnostics)
+
+			if !slices.Equal(names, test.Names) || len(payloads.Diagnostics) != test.Diagnostics {
+				t.Fail()
+			}
+			if len(names) > 0 && strings.HasSuffix(names[0], ".pdf") && string(payloads.Parts[1].Contents) != pdf {
+				t.Errorf(`Contents differ`)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime/quotedprintable"
+	"strings"
+)
+
+const (
+	TransferEncodingBase64          string = "base64"
+	TransferEncodingQuotedPrintable        = "quoted-printable"
+)
+
+// decodeTransferEncoding decodes part contents according to Content-Transfer-Encoding header.
+// Second value is true if contents were actually decoded.
+func decodeTransferEncoding(encoding string, data []byte) ([]byte, bool, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "7bit", "8bit", "binary":
+		return data, false, nil
+
+	case TransferEncodingBase64:
+		// line breaks and padding are not always consistent
+		cleaned := bytes.Map(func(r rune) rune {
+			switch r {
+			case '\r', '\n', ' ', '\t':
+				return -1
+			}
+			return r
+		}, data)
+
+		decoded, err := base64.StdEncoding.DecodeString(string(cleaned))
+		if err != nil {
+			decoded, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(string(cleaned), "="))
+		}
+		if err != nil {
+			return data, false, err
+		}
+		return decoded, true, nil
+
+	case TransferEncodingQuotedPrintable:
+		decoded, err := io.ReadAll(quotedprintable.NewReader(bytes.NewReader(data)))
+		if err != nil {
+			return data, false, err
+		}
+		return decoded, true, nil
+
+	default:
+		return data, false, fmt.Errorf("unsupported transfer encoding [%s]", encoding)
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"path"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// content types which do not say anything about the contents, sniffing is used instead
+var genericContentTypes = []string{"", "application/octet-stream", "text/plain", "application/unknown", "binary/octet-stream"}
+
+var contentTypeExtensions = map[string]string{
+	"application/xml":              ".xml",
+	"text/xml":                     ".xml",
+	"application/json":             ".json",
+	"text/json":                    ".json",
+	"application/pdf":              ".pdf",
+	"application/zip":              ".zip",
+	"application/x-zip-compressed": ".zip",
+	"application/gzip":             ".gz",
+	"application/x-gzip":           ".gz",
+	"text/csv":                     ".csv",
+	"text/comma-separated-values":  ".csv",
+	"application/edifact":          ".edi",
+	"application/edi-x12":          ".x12",
+	"text/html":                    ".html",
+	"image/png":                    ".png",
+	"image/jpeg":                   ".jpg",
+	"image/gif":                    ".gif",
+	"image/tiff":                   ".tif",
+}
+
+// part names which already have one of these extensions are left as-is, any other
+// suffix (cid:payload-6b1c@sap.com, Invoice 2023.11) is a part of the name
+var knownExtensions = knownExtensionList()
+
+func knownExtensionList() []string {
+	// sniffed types which do not have own content type
+	extensions := []string{".txt", ".idoc", ".jpeg", ".tiff", ".htm"}
+	for _, ext := range contentTypeExtensions {
+		if !slices.Contains(extensions, ext) {
+			extensions = append(extensions, ext)
+		}
+	}
+	return extensions
+}
+
+// inferExtensions sets extension for payloads based on Content-Type of the part
+// or (if it is not informative) on the contents. Extension is appended to the
+// filename by processDuplicateFilenames.
+func inferExtensions(payloads *XIMessagePayloads) {
+	for i := range payloads.Parts {
+		part := &payloads.Parts[i]
+
+		if part.Kind != PayloadKindPayload || part.Extension != "" {
+			continue
+		}
+		if slices.Contains(knownExtensions, strings.ToLower(path.Ext(part.Name))) {
+			continue
+		}
+
+		ext, source := inferExtension(part.ContentType, part.Contents)
+		if ext == "" {
+			continue
+		}
+
+		part.Extension = ext
+		part.Notes = append(part.Notes, fmt.Sprintf("extension:%s from %s", ext, source))
+	}
+}
+
+func inferExtension(contentType string, data []byte) (string, string) {
+	mediatype, _, _ := mime.ParseMediaType(contentType)
+	mediatype = strings.ToLower(mediatype)
+
+	isGeneric := false
+	for _, generic := range genericContentTypes {
+		if mediatype == generic {
+			isGeneric = true
+			break
+		}
+	}
+
+	if !isGeneric {
+		if ext, ok := contentTypeExtensions[mediatype]; ok {
+			return ext, "content-type"
+		}
+		switch {
+		case strings.HasSuffix(mediatype, "+xml"):
+			return ".xml", "content-type"
+		case strings.HasSuffix(mediatype, "+json"):
+			return ".json", "content-type"
+		}
+	}
+
+	ext := sniffExtension(data)
+	if ext == "" && mediatype == "text/plain" {
+		ext = ".txt"
+	}
+	if ext == "" {
+		return "", ""
+	}
+	return ext, "content"
+}
+
+// sniffExtension detects type of the contents by magic bytes and structure
+func sniffExtension(data []byte) string {
+	// binary formats
+	switch {
+	case bytes.HasPrefix(data, []byte("%PDF-")):
+		return ".pdf"
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")), bytes.HasPrefix(data, []byte("PK\x05\x06")):
+		return ".zip"
+	case bytes.HasPrefix(data, []byte("\x1f\x8b")):
+		return ".gz"
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return ".png"
+	case bytes.HasPrefix(data, []byte("\xff\xd8\xff")):
+		return ".jpg"
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return ".gif"
+	case bytes.HasPrefix(data, []byte("II*\x00")), bytes.HasPrefix(data, []byte("MM\x00*")):
+		return ".tif"
+	}
+
+	text := sniffTextPrefix(data, 4096)
+	trimmed := strings.TrimLeft(text, " \t\r\n")
+
+	switch {
+	case trimmed == "":
+		return ""
+	case strings.HasPrefix(trimmed, "<"):
+		if len(trimmed) > 1 && (trimmed[1] == '?' || trimmed[1] == '!' || isNameStart(trimmed[1])) {
+			return ".xml"
+		}
+	case strings.HasPrefix(trimmed, "{"), strings.HasPrefix(trimmed, "["):
+		if json.Valid(bytes.TrimSpace(data)) {
+			return ".json"
+		}
+	case strings.HasPrefix(trimmed, "UNA:"), strings.HasPrefix(trimmed, "UNB+"):
+		return ".edi"
+	case len(trimmed) > 4 && strings.HasPrefix(trimmed, "ISA") && strings.ContainsRune("*|^~", rune(trimmed[3])):
+		return ".x12"
+	case strings.HasPrefix(trimmed, "EDI_DC40"):
+		return ".idoc"
+	}
+
+	// anything binary is not a text format
+	complete := text
+	if len(data) > len(text) && len(complete) > utf8.UTFMax {
+		// last character may be cut in the middle
+		complete = complete[:len(complete)-utf8.UTFMax]
+	}
+	if !utf8.ValidString(complete) || strings.ContainsRune(complete, 0) {
+		return ""
+	}
+
+	if looksLikeCSV(text) {
+		return ".csv"
+	}
+
+	return ""
+}
+
+// sniffTextPrefix returns beginning of the contents as text, byte order marks are removed
+// and UTF-16 is reduced to ASCII characters which is enough for detection
+func sniffTextPrefix(data []byte, limit int) string {
+	if len(data) > limit {
+		data = data[:limit]
+	}
+
+	switch {
+	case bytes.HasPrefix(data, []byte("\xef\xbb\xbf")):
+		return string(data[3:])
+	case bytes.HasPrefix(data, []byte("\xff\xfe")), bytes.HasPrefix(data, []byte("\xfe\xff")):
+		// low byte goes first in little endian
+		low := 0
+		if data[0] == 0xfe {
+			low = 1
+		}
+
+		var result strings.Builder
+		for i := 2; i+1 < len(data); i += 2 {
+			result.WriteByte(data[i+low])
+		}
+		return result.String()
+	}
+
+	return string(data)
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || c == ':' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+// looksLikeCSV checks that first lines have the same non-zero number of one of common delimiters
+func looksLikeCSV(text string) bool {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	if len(lines) > 10 {
+		lines = lines[:10]
+	}
+	// last line may be incomplete or empty
+	if len(lines) > 2 {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) < 2 {
+		return false
+	}
+
+	for _, delimiter := range []string{",", ";", "\t", "|"} {
+		count := strings.Count(lines[0], delimiter)
+		if count == 0 {
+			continue
+		}
+
+		consistent := true
+		for _, line := range lines[1:] {
+			if strings.Count(line, delimiter) != count {
+				consistent = false
+				break
+			}
+		}
+
+		if consistent {
+			return true
+		}
+	}
+
+	return false
+}
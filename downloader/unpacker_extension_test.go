@@ -0,0 +1,83 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestInferExtension(t *testing.T) {
+	tests := []struct {
+		Index       string
+		ContentType string
+		Contents    string
+		Expected    string
+	}{
+		{"01", "application/xml", "anything", ".xml"},
+		{"02", "text/xml; charset=utf-8", "anything", ".xml"},
+		{"03", "application/soap+xml", "anything", ".xml"},
+		{"04", "application/vnd.api+json", "anything", ".json"},
+		{"05", "application/octet-stream", "  <?xml version=\"1.0\"?><a/>", ".xml"},
+		{"06", "", "<ns0:Order xmlns:ns0=\"urn:x\"/>", ".xml"},
+		{"07", "", "\xef\xbb\xbf<Order/>", ".xml"},
+		{"08", "", "\xff\xfe<\x00a\x00/\x00>\x00", ".xml"},
+		{"09", "", "\xfe\xff\x00<\x00a\x00/\x00>", ".xml"},
+		{"10", "", "{\"order\": 1}", ".json"},
+		{"11", "", "{\"order\": ", ""},
+		{"12", "", "%PDF-1.7\n", ".pdf"},
+		{"13", "", "PK\x03\x04\x14\x00", ".zip"},
+		{"14", "", "UNA:+.? 'UNB+UNOC:3+SENDER+RECEIVER+231121:0905+1'", ".edi"},
+		{"15", "", "UNB+UNOC:3+SENDER+RECEIVER+231121:0905+1'", ".edi"},
+		{"16", "", "ISA*00*          *00*          *ZZ*SENDER         *ZZ*RECEIVER       *231121*0905*U*00401*000000001*0*P*>~", ".x12"},
+		{"17", "", "EDI_DC40  100000000000123456740 3012  ORDERS05", ".idoc"},
+		{"18", "", "order;material;quantity\r\n1;M-100;5\r\n2;M-200;7\r\n", ".csv"},
+		{"19", "", "order,material\n1,M-100\n", ".csv"},
+		{"20", "", "Hello, World\nJust text\n", ""},
+		{"21", "text/plain", "Hello, World\nJust text\n", ".txt"},
+		{"22", "text/plain", "<a/>", ".xml"},
+		{"23", "", "\x00\x01\x02,\n\x00,\n", ""},
+		{"24", "application/x-custom", "{}", ".json"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Index, func(t *testing.T) {
+			ext, source := inferExtension(test.ContentType, []byte(test.Contents))
+			t.Logf(`Expected: %s, got: %s (%s)`, test.Expected, ext, source)
+
+			if ext != test.Expected {
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestExtensionsWithDuplicates(t *testing.T) {
+	payloads := XIMessagePayloads{
+		Parts: []XIPayload{
+			{Filename: "MainDocument", Name: "MainDocument", Kind: PayloadKindPayload, ContentType: "application/xml"},
+			{Filename: "MainDocument", Name: "MainDocument", Kind: PayloadKindPayload, ContentType: "application/xml"},
+			{Filename: "MainDocument", Name: "MainDocument", Kind: PayloadKindPayload, ContentType: "application/json"},
+			{Filename: "invoice.pdf", Name: "invoice.pdf", Kind: PayloadKindPayload, ContentType: "application/pdf"},
+			{Filename: "XIHEADER.xml", Name: "XIHEADER.xml", Kind: PayloadKindXIHeader, ContentType: "text/xml"},
+			{Filename: "RAW", Name: "RAW", Kind: PayloadKindRaw},
+			{Filename: "cid:payload-6b1c@sap.com", Name: "cid:payload-6b1c@sap.com", Kind: PayloadKindPayload, ContentType: "application/xml"},
+			{Filename: "Invoice 2023.11", Name: "Invoice 2023.11", Kind: PayloadKindPayload, ContentType: "application/octet-stream", Contents: []byte("%PDF-1.4")},
+			{Filename: "ORDERS.XML", Name: "ORDERS.XML", Kind: PayloadKindPayload, ContentType: "application/xml"},
+		},
+	}
+
+	inferExtensions(&payloads)
+	processDuplicateFilenames(&payloads)
+
+	expected := []string{"MainDocument.xml", "MainDocument_2.xml", "MainDocument.json", "invoice.pdf", "XIHEADER.xml", "RAW", "cid:payload-6b1c@sap.com.xml", "Invoice 2023.11.pdf", "ORDERS.XML"}
+
+	var filenames []string
+	for _, part := range payloads.Parts {
+		filenames = append(filenames, part.Filename)
+	}
+	t.Logf(`Expected: %#v`, expected)
+	t.Logf(`Got     : %#v`, filenames)
+
+	if !slices.Equal(filenames, expected) {
+		t.Fail()
+	}
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+type PayloadFormatMode string
+
+const (
+	PayloadFormatNone      PayloadFormatMode = "none"
+	PayloadFormatReplace                     = "replace"
+	PayloadFormatAlongside                   = "alongside"
+)
+
+const FormattedFilenameSuffix string = ".formatted"
+
+func processFormatFlag(input string) (PayloadFormatMode, error) {
+	switch strings.TrimSpace(strings.ToLower(input)) {
+	case "", "n", "none":
+		return PayloadFormatNone, nil
+	case "r", "replace":
+		return PayloadFormatReplace, nil
+	case "a", "alongside":
+		return PayloadFormatAlongside, nil
+	default:
+		return PayloadFormatNone, fmt.Errorf(`Format option [%s] is unknown`, input)
+	}
+}
+
+func processIndentFlag(input string) (string, error) {
+	input = strings.TrimSpace(strings.ToLower(input))
+	if input == "tab" || input == "t" {
+		return "\t", nil
+	}
+
+	var width int
+	_, err := fmt.Sscanf(input, "%d", &width)
+	if err != nil || width < 0 || width > 16 || fmt.Sprint(width) != input {
+		return "", fmt.Errorf(`Indentation [%s] is incorrect, use number of spaces (0-16) or "tab"`, input)
+	}
+
+	return strings.Repeat(" ", width), nil
+}
+
+// formatPayloads pretty-prints XML and JSON payloads, either in place
+// or as additional files next to the original ones
+func formatPayloads(options RuntimeConfiguration, payloads *XIMessagePayloads) {
+	formatted := []XIPayload{}
+
+	for i := range payloads.Parts {
+		part := &payloads.Parts[i]
+		if part.Kind != PayloadKindPayload && part.Kind != PayloadKindXIHeader {
+			continue
+		}
+
+		var result []byte
+		var err error
+		var note string
+
+		switch ext, _ := inferExtension(part.ContentType, part.Contents); ext {
+		case ".xml":
+			result, err = formatXML(part.Contents, options.FormatIndent, options.FormatCanonicalXML)
+			note = "formatted:xml"
+			if options.FormatCanonicalXML {
+				note = "formatted:xml-c14n"
+			}
+		case ".json":
+			result, err = formatJSON(part.Contents, options.FormatIndent, options.FormatSortJSONKeys)
+			note = "formatted:json"
+			if options.FormatSortJSONKeys {
+				note = "formatted:json-sorted"
+			}
+		default:
+			continue
+		}
+
+		if err != nil {
+			part.Notes = append(part.Notes, fmt.Sprintf("not formatted: %s", err))
+			continue
+		}
+
+		switch options.FormatMode {
+		case PayloadFormatReplace:
+			part.Contents = result
+			part.Notes = append(part.Notes, note)
+
+		case PayloadFormatAlongside:
+			copied := *part
+			copied.Filename += FormattedFilenameSuffix
+			copied.Kind = PayloadKindFormatted
+			copied.Contents = result
+			copied.Notes = append(append([]string{}, part.Notes...), note)
+			formatted = append(formatted, copied)
+		}
+	}
+
+	payloads.Parts = append(payloads.Parts, formatted...)
+}
+
+func formatJSON(data []byte, indent string, sortKeys bool) ([]byte, error) {
+	if !sortKeys {
+		buffer := new(bytes.Buffer)
+		err := json.Indent(buffer, bytes.TrimSpace(data), "", indent)
+		return buffer.Bytes(), err
+	}
+
+	// maps are encoded with sorted keys, numbers are kept as-is
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value any
+	err := decoder.Decode(&value)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return nil, errors.New("unexpected data after JSON value")
+	}
+
+	buffer := new(bytes.Buffer)
+	encoder := json.NewEncoder(buffer)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", indent)
+
+	err = encoder.Encode(value)
+	return bytes.TrimRight(buffer.Bytes(), "\n"), err
+}
+
+// formatXML re-indents XML document keeping namespace prefixes intact. Elements with
+// text content (including mixed content) are written on one line. Canonical mode follows
+// C14N rules where possible: no XML declaration, DOCTYPE and comments, attributes sorted,
+// empty elements written as start-end tag pairs and C14N character escaping.
+func formatXML(data []byte, indent string, canonical bool) ([]byte, error) {
+	// well-formedness check, RawToken below does not match start and end tags
+	validator := xml.NewDecoder(bytes.NewReader(data))
+	roots, level := 0, 0
+	for {
+		token, err := validator.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch token.(type) {
+		case xml.StartElement:
+			if level == 0 {
+				roots++
+			}
+			level++
+		case xml.EndElement:
+			level--
+		}
+	}
+	if roots != 1 {
+		return nil, fmt.Errorf("document has %d root elements", roots)
+	}
+
+	tokens := []xml.Token{}
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.RawToken()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, xml.CopyToken(token))
+	}
+
+	// elements with non-whitespace text are written inline
+	mixed := make(map[int]bool)
+	stack := []int{}
+	for i, token := range tokens {
+		switch t := token.(type) {
+		case xml.StartElement:
+			stack = append(stack, i)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 && len(bytes.TrimSpace(t)) > 0 {
+				mixed[stack[len(stack)-1]] = true
+			}
+		}
+	}
+
+	out := new(bytes.Buffer)
+	inline := []bool{false}
+	namespaces := []map[string]string{{"xml": "http://www.w3.org/XML/1998/namespace"}}
+	depth := 0
+
+	newline := func() {
+		if out.Len() > 0 {
+			out.WriteByte('\n')
+		}
+		out.WriteString(strings.Repeat(indent, depth))
+	}
+
+	for i := 0; i < len(tokens); i++ {
+		current := inline[len(inline)-1]
+
+		switch t := tokens[i].(type) {
+		case xml.ProcInst:
+			if canonical && t.Target == "xml" {
+				continue
+			}
+			if !current {
+				newline()
+			}
+			fmt.Fprintf(out, "<?%s", t.Target)
+			if len(t.Inst) > 0 {
+				fmt.Fprintf(out, " %s", t.Inst)
+			}
+			out.WriteString("?>")
+
+		case xml.Directive:
+			if canonical {
+				continue
+			}
+			newline()
+			fmt.Fprintf(out, "<!%s>", t)
+
+		case xml.Comment:
+			if canonical {
+				continue
+			}
+			if !current {
+				newline()
+			}
+			fmt.Fprintf(out, "<!--%s-->", t)
+
+		case xml.CharData:
+			if current {
+				out.WriteString(escapeXMLText(string(t), canonical))
+			}
+
+		case xml.StartElement:
+			scope := make(map[string]string)
+			for _, attr := range t.Attr {
+				switch {
+				case attr.Name.Space == "xmlns":
+					scope[attr.Name.Local] = attr.Value
+				case attr.Name.Space == "" && attr.Name.Local == "xmlns":
+					scope[""] = attr.Value
+				}
+			}
+			namespaces = append(namespaces, scope)
+
+			attrs := t.Attr
+			if canonical {
+				attrs = sortAttributesC14N(attrs, namespaces)
+			}
+
+			if !current {
+				newline()
+			}
+			out.WriteString("<" + rawName(t.Name))
+			for _, attr := range attrs {
+				fmt.Fprintf(out, ` %s="%s"`, rawName(attr.Name), escapeXMLAttribute(attr.Value, canonical))
+			}
+
+			// empty element, possibly with whitespace inside
+			j := i + 1
+			for j < len(tokens) {
+				if text, ok := tokens[j].(xml.CharData); ok && len(bytes.TrimSpace(text)) == 0 {
+					j++
+					continue
+				}
+				break
+			}
+			if j < len(tokens) {
+				if _, ok := tokens[j].(xml.EndElement); ok {
+					if canonical {
+						fmt.Fprintf(out, "></%s>", rawName(t.Name))
+					} else {
+						out.WriteString("/>")
+					}
+					namespaces = namespaces[:len(namespaces)-1]
+					i = j
+					continue
+				}
+			}
+
+			out.WriteString(">")
+			inline = append(inline, current || mixed[i])
+			depth++
+
+		case xml.EndElement:
+			inline = inline[:len(inline)-1]
+			namespaces = namespaces[:len(namespaces)-1]
+			depth--
+			if !current {
+				newline()
+			}
+			fmt.Fprintf(out, "</%s>", rawName(t.Name))
+		}
+	}
+
+	return out.Bytes(), nil
+}
+
+func rawName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
+
+// sortAttributesC14N puts namespace declarations first (sorted by prefix), then other
+// attributes sorted by namespace URI and local name
+func sortAttributesC14N(attrs []xml.Attr, namespaces []map[string]string) []xml.Attr {
+	resolve := func(prefix string) string {
+		for i := len(namespaces) - 1; i >= 0; i-- {
+			if uri, ok := namespaces[i][prefix]; ok {
+				return uri
+			}
+		}
+		return prefix
+	}
+
+	type sortable struct {
+		attr      xml.Attr
+		namespace bool
+		key       string
+	}
+
+	list := make([]sortable, 0, len(attrs))
+	for _, attr := range attrs {
+		switch {
+		case attr.Name.Space == "" && attr.Name.Local == "xmlns":
+			list = append(list, sortable{attr, true, ""})
+		case attr.Name.Space == "xmlns":
+			list = append(list, sortable{attr, true, attr.Name.Local})
+		case attr.Name.Space == "":
+			list = append(list, sortable{attr, false, "\x00" + attr.Name.Local})
+		default:
+			list = append(list, sortable{attr, false, resolve(attr.Name.Space) + "\x00" + attr.Name.Local})
+		}
+	}
+
+	sort.SliceStable(list, func(a, b int) bool {
+		if list[a].namespace != list[b].namespace {
+			return list[a].namespace
+		}
+		return list[a].key < list[b].key
+	})
+
+	result := make([]xml.Attr, len(list))
+	for i := range list {
+		result[i] = list[i].attr
+	}
+	return result
+}
+
+func escapeXMLText(text string, canonical bool) string {
+	replacer := strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	if canonical {
+		replacer = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+	}
+	return replacer.Replace(text)
+}
+
+func escapeXMLAttribute(text string, canonical bool) string {
+	replacer := strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;", "\n", "&#xA;")
+	if canonical {
+		replacer = strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;", "\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+	}
+	return replacer.Replace(text)
+}
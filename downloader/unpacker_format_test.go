@@ -0,0 +1,117 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFormatXML(t *testing.T) {
+	tests := []struct {
+		Index     string
+		Input     string
+		Indent    string
+		Canonical bool
+		Expected  string
+		Error     bool
+	}{
+		{"01", `<a><b>text</b><c/></a>`, "  ", false, "<a>\n  <b>text</b>\n  <c/>\n</a>", false},
+		{"02", `<?xml version="1.0"?><ns0:a xmlns:ns0="urn:x"><ns0:b>1</ns0:b></ns0:a>`, "\t", false, "<?xml version=\"1.0\"?>\n<ns0:a xmlns:ns0=\"urn:x\">\n\t<ns0:b>1</ns0:b>\n</ns0:a>", false},
+		{"03", `<a>  <b>  </b>  </a>`, "  ", false, "<a>\n  <b/>\n</a>", false},
+		{"04", `<p>one <b>two</b> three</p>`, "  ", false, "<p>one <b>two</b> three</p>", false},
+		{"05", `<a><!-- note --><b>&lt;&amp;</b></a>`, " ", false, "<a>\n <!-- note -->\n <b>&lt;&amp;</b>\n</a>", false},
+		{"06", `<?xml version="1.0"?><!-- note --><a z="1" xmlns:p="urn:p" p:y="2" xmlns="urn:d" x="3"><b/></a>`, "  ", true, "<a xmlns=\"urn:d\" xmlns:p=\"urn:p\" x=\"3\" z=\"1\" p:y=\"2\">\n  <b></b>\n</a>", false},
+		{"07", `<a b="x&#9;y">z</a>`, "", true, "<a b=\"x&#x9;y\">z</a>", false},
+		{"08", `<a><b></a>`, "  ", false, "", true},
+		{"09", `<a></a><b/>`, "  ", false, "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Index, func(t *testing.T) {
+			result, err := formatXML([]byte(test.Input), test.Indent, test.Canonical)
+			t.Logf(`Result: %q, error: %v`, result, err)
+
+			if (err != nil) != test.Error || (err == nil && string(result) != test.Expected) {
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestFormatJSON(t *testing.T) {
+	tests := []struct {
+		Index    string
+		Input    string
+		SortKeys bool
+		Expected string
+		Error    bool
+	}{
+		{"01", `{"b":1,"a":[true,null]}`, false, "{\n  \"b\": 1,\n  \"a\": [\n    true,\n    null\n  ]\n}", false},
+		{"02", `{"b":1.50,"a":{"d":"<&>","c":1e3}}`, true, "{\n  \"a\": {\n    \"c\": 1e3,\n    \"d\": \"<&>\"\n  },\n  \"b\": 1.50\n}", false},
+		{"03", `{"a":`, false, "", true},
+		{"04", `{"a":1} {"b":2}`, true, "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Index, func(t *testing.T) {
+			result, err := formatJSON([]byte(test.Input), "  ", test.SortKeys)
+			t.Logf(`Result: %q, error: %v`, result, err)
+
+			if (err != nil) != test.Error || (err == nil && string(result) != test.Expected) {
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestFormatPayloads(t *testing.T) {
+	quietDiagnostics = true
+	defer func() { quietDiagnostics = false }()
+
+	data, err := os.ReadFile(filepath.Join("testdata", "messages", "01.async.xml.testdata"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	original := UnpackParts(RuntimeConfiguration{}, testMessageVersion(), data)
+
+	tests := []struct {
+		Mode      PayloadFormatMode
+		Filenames []string
+		Formatted int
+	}{
+		{PayloadFormatNone, []string{"MainDocument"}, -1},
+		{PayloadFormatReplace, []string{"MainDocument"}, 0},
+		{PayloadFormatAlongside, []string{"MainDocument", "MainDocument.formatted"}, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.Mode), func(t *testing.T) {
+			payloads := UnpackParts(RuntimeConfiguration{FormatMode: test.Mode, FormatIndent: "  "}, testMessageVersion(), data)
+
+			var filenames []string
+			for _, part := range payloads.Parts {
+				filenames = append(filenames, filepath.Base(part.Filename))
+			}
+			t.Logf(`Filenames: %#v`, filenames)
+
+			if len(filenames) != len(test.Filenames) {
+				t.Fatal()
+			}
+			for i := range filenames {
+				if !strings.HasSuffix(filenames[i], "."+test.Filenames[i]) {
+					t.Fail()
+				}
+			}
+
+			// raw bytes stay as they are unless replaced
+			for i, part := range payloads.Parts {
+				changed := string(part.Contents) != string(original.Parts[0].Contents)
+				if changed != (i == test.Formatted) {
+					t.Errorf(`Part %d changed: %v`, i, changed)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/textproto"
+	"strings"
+)
+
+// upper limit for a header block, anything longer is not a header
+const MaxHeaderBlockSize int = 64 * 1024
+
+// nextHeaderLine returns line starting at pos and position of the next line.
+// Any of \r\n, \n\r, \n and \r is accepted as line terminator, SAP PO is known
+// to produce \n\r in some releases.
+func nextHeaderLine(data []byte, pos int) ([]byte, int, bool) {
+	if pos >= len(data) {
+		return nil, pos, false
+	}
+
+	end := bytes.IndexAny(data[pos:], "\r\n")
+	if end == -1 {
+		// last line without terminator
+		return data[pos:], len(data), true
+	}
+
+	end += pos
+	next := end + 1
+	if next < len(data) && data[next] != data[end] && (data[next] == '\r' || data[next] == '\n') {
+		// two-byte terminator
+		next++
+	}
+
+	return data[pos:end], next, true
+}
+
+// parseMessageHeaders is a tolerant parser of RFC 5322 / RFC 2045 header block at the start
+// of XI message. It returns parsed headers, remaining body and a list of problems found.
+// Folded headers are unfolded, malformed lines are skipped.
+func parseMessageHeaders(data []byte) (textproto.MIMEHeader, []byte, []string) {
+	headers := make(textproto.MIMEHeader)
+	diagnostics := []string{}
+
+	lastKey := ""
+	pos := 0
+
+	// leading empty lines are not allowed by RFC but harmless
+	for {
+		line, next, ok := nextHeaderLine(data, pos)
+		if !ok || len(bytes.TrimSpace(line)) > 0 {
+			break
+		}
+		if pos == 0 {
+			diagnostics = append(diagnostics, "empty lines before message headers")
+		}
+		pos = next
+	}
+
+	for {
+		if pos > MaxHeaderBlockSize {
+			diagnostics = append(diagnostics, fmt.Sprintf("header block exceeds %d bytes, rest is treated as body", MaxHeaderBlockSize))
+			return headers, data[pos:], diagnostics
+		}
+
+		line, next, ok := nextHeaderLine(data, pos)
+		if !ok {
+			diagnostics = append(diagnostics, "message has no body")
+			return headers, nil, diagnostics
+		}
+
+		if len(bytes.TrimSpace(line)) == 0 {
+			// end of header block
+			return headers, data[next:], diagnostics
+		}
+
+		text := string(line)
+
+		switch {
+		case text[0] == ' ' || text[0] == '\t':
+			// folded header
+			if lastKey == "" {
+				diagnostics = append(diagnostics, fmt.Sprintf("continuation line without header skipped: %s", quoteHeaderLine(text)))
+				break
+			}
+			values := headers[lastKey]
+			values[len(values)-1] = strings.TrimSpace(values[len(values)-1] + " " + strings.TrimSpace(text))
+
+		case strings.HasPrefix(text, "--"):
+			// multipart boundary right after headers, empty line is missing
+			diagnostics = append(diagnostics, "no empty line between headers and body")
+			return headers, data[pos:], diagnostics
+
+		default:
+			key, value, found := strings.Cut(text, ":")
+			key = strings.TrimSpace(key)
+			if !found || key == "" || strings.ContainsAny(key, " \t") {
+				diagnostics = append(diagnostics, fmt.Sprintf("malformed header line skipped: %s", quoteHeaderLine(text)))
+				lastKey = ""
+				break
+			}
+
+			lastKey = textproto.CanonicalMIMEHeaderKey(key)
+			headers.Add(lastKey, strings.TrimSpace(value))
+		}
+
+		pos = next
+	}
+}
+
+// normalizeMultipartHeaders rewrites header blocks of every part of multipart body
+// with \r\n line terminators and removes malformed header lines, so that
+// mime/multipart can read the parts. Part contents are left untouched.
+func normalizeMultipartHeaders(body []byte, boundary string) ([]byte, []string) {
+	diagnostics := []string{}
+	if boundary == "" {
+		return body, diagnostics
+	}
+
+	delimiter := []byte("--" + boundary)
+	result := make([]byte, 0, len(body)+256)
+	pos := 0
+
+	for {
+		idx := bytes.Index(body[pos:], delimiter)
+		if idx == -1 {
+			result = append(result, body[pos:]...)
+			break
+		}
+
+		start := pos + idx
+		end := start + len(delimiter)
+		result = append(result, body[pos:start]...)
+		pos = end
+
+		if start > 0 && body[start-1] != '\n' && body[start-1] != '\r' {
+			// not at the line start, part of the contents
+			result = append(result, delimiter...)
+			continue
+		}
+
+		// line break before delimiter belongs to delimiter, make it \r\n as well
+		switch {
+		case bytes.HasSuffix(result, []byte("\r\n")):
+			// noop
+		case bytes.HasSuffix(result, []byte("\n\r")):
+			result[len(result)-2], result[len(result)-1] = '\r', '\n'
+		case bytes.HasSuffix(result, []byte("\r")):
+			result = append(result, '\n')
+		case bytes.HasSuffix(result, []byte("\n")):
+			result[len(result)-1] = '\r'
+			result = append(result, '\n')
+		}
+		result = append(result, delimiter...)
+
+		if bytes.HasPrefix(body[pos:], []byte("--")) {
+			// closing delimiter, anything after it is epilogue
+			line, next, _ := nextHeaderLine(body, pos)
+			result = append(result, bytes.TrimRight(line, " \t")...)
+			result = append(result, '\r', '\n')
+			result = append(result, body[next:]...)
+			break
+		}
+
+		// rest of delimiter line (transport padding)
+		line, next, ok := nextHeaderLine(body, pos)
+		if !ok {
+			break
+		}
+		result = append(result, bytes.TrimRight(line, " \t")...)
+		result = append(result, '\r', '\n')
+		pos = next
+
+		// part headers
+		for {
+			line, next, ok := nextHeaderLine(body, pos)
+			if !ok {
+				diagnostics = append(diagnostics, "part headers are not terminated")
+				return result, diagnostics
+			}
+			pos = next
+
+			if len(bytes.TrimSpace(line)) == 0 {
+				result = append(result, '\r', '\n')
+				break
+			}
+
+			text := string(line)
+			key, _, found := strings.Cut(text, ":")
+			continuation := text[0] == ' ' || text[0] == '\t'
+			if !continuation && (!found || strings.TrimSpace(key) == "" || strings.ContainsAny(strings.TrimSpace(key), " \t")) {
+				diagnostics = append(diagnostics, fmt.Sprintf("malformed part header line skipped: %s", quoteHeaderLine(text)))
+				continue
+			}
+
+			result = append(result, line...)
+			result = append(result, '\r', '\n')
+		}
+	}
+
+	return result, diagnostics
+}
+
+func quoteHeaderLine(line string) string {
+	const limit = 80
+	if len(line) > limit {
+		line = line[:limit] + "..."
+	}
+	return fmt.Sprintf("%q", line)
+}
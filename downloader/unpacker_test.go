@@ -0,0 +1,247 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMessageHeaders(t *testing.T) {
+	tests := []struct {
+		Index       string
+		Input       string
+		ContentType string
+		Body        string
+		Diagnostics int
+	}{
+		{"01", "Content-Type: a/b\r\n\r\nbody", "a/b", "body", 0},
+		{"02", "content-type:a/b\n\nbody", "a/b", "body", 0},
+		{"03", "content-type:a/b\n\r\nbody", "a/b", "body", 0},
+		{"04", "content-type:a/b\r\rbody", "a/b", "body", 0},
+		{"05", "Content-Type: a/b;\r\n\tboundary=x;\r\n start=y\r\n\r\nbody", "a/b; boundary=x; start=y", "body", 0},
+		{"06", "no colon here\r\nContent-Type: a/b\r\n\r\nbody", "a/b", "body", 1},
+		{"07", "Content-Type: a/b\r\n--boundary\r\n", "a/b", "--boundary\r\n", 1},
+		{"08", "\r\n\r\nContent-Type: a/b\r\n\r\nbody", "a/b", "body", 1},
+		{"09", " folded\r\nContent-Type: a/b\r\n\r\n", "a/b", "", 1},
+		{"10", "Content-Type: a/b", "a/b", "", 1},
+		{"11", "", "", "", 1},
+		{"12", ": empty key\r\nContent Type: a/b\r\n\r\nbody", "", "body", 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Index, func(t *testing.T) {
+			headers, body, diagnostics := parseMessageHeaders([]byte(test.Input))
+			t.Logf(`Headers    : %#v`, headers)
+			t.Logf(`Body       : %q`, body)
+			t.Logf(`Diagnostics: %#v`, diagnostics)
+
+			if headers.Get("Content-Type") != test.ContentType || string(body) != test.Body || len(diagnostics) != test.Diagnostics {
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestUnpackMessages(t *testing.T) {
+	quietDiagnostics = true
+	defer func() { quietDiagnostics = false }()
+
+	tests := []struct {
+		Filename    string
+		Parts       []string
+		Diagnostics int
+	}{
+		{"01.async.xml.testdata", []string{"MainDocument"}, 0},
+		{"02.quirk.testdata", []string{"MainDocument"}, 0},
+		{"03.attachments.testdata", []string{"MainDocument", "invoice", "ApplicationAttachment"}, 0},
+		{"04.lf.json.testdata", []string{"MainDocument"}, 0},
+		{"05.broken.testdata", []string{"MainDocument"}, 3},
+		{"06.plain.testdata", []string(nil), 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Filename, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", "messages", test.Filename))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			payloads := UnpackParts(RuntimeConfiguration{}, testMessageVersion(), data)
+
+			var parts []string
+			for _, part := range payloads.Parts {
+				parts = append(parts, part.Name)
+			}
+			t.Logf(`Parts      : %#v`, parts)
+			t.Logf(`Diagnostics: %#v`, payloads.Diagnostics)
+
+			if !slices.Equal(parts, test.Parts) || len(payloads.Diagnostics) != test.Diagnostics {
+				t.Fail()
+			}
+		})
+	}
+}
+
+func FuzzUnpackParts(f *testing.F) {
+	quiet := quietDiagnostics
+	quietDiagnostics = true
+	f.Cleanup(func() { quietDiagnostics = quiet })
+
+	// testdata/fuzz/FuzzUnpackParts is added by go test as well: anonymised NWA downloads,
+	// mixed CRLF/LF line endings, missing and wrong boundaries
+	samples, _ := filepath.Glob(filepath.Join("testdata", "messages", "*.testdata"))
+	for _, sample := range samples {
+		data, err := os.ReadFile(sample)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		parseMessageHeaders(data)
+		UnpackParts(RuntimeConfiguration{SaveRawContent: true, SaveXIHeader: true}, testMessageVersion(), data)
+	})
+}
+
+func testMessageVersion() XIMessageVersion {
+	return XIMessageVersion{
+		MessageInfo: XIAdapterMessage{
+			MessageID:  "6b1c3e2e-8a11-11ee-b8d6-00000c9d89ea",
+			MessageKey: "6b1c3e2e-8a11-11ee-b8d6-00000c9d89ea\\OUTBOUND\\0\\EO\\0\\",
+			Direction:  "OUTBOUND",
+		},
+		VersionType:    VersionTypeLogged,
+		MessageVersion: "MS",
+	}
+}
+
+func TestUnpackBase64Error(t *testing.T) {
+	quietDiagnostics = true
+	defer func() { quietDiagnostics = false }()
+
+	entry := testMessageVersion()
+	entry.Base64Contents = "not*base64"
+
+	payloads := UnpackPartsBase64(RuntimeConfiguration{}, entry)
+	t.Logf(`Message: %s, version: %s, diagnostics: %#v`, payloads.MessageID, payloads.VersionID, payloads.Diagnostics)
+
+	if payloads.MessageID != entry.MessageInfo.MessageID || payloads.VersionID != "LOG.MS" || len(payloads.Diagnostics) != 1 || len(payloads.Parts) != 0 {
+		t.Fail()
+	}
+}
+
+func TestTransferEncoding(t *testing.T) {
+	tests := []struct {
+		Index    string
+		Encoding string
+		Input    string
+		Expected string
+		Decoded  bool
+		Error    bool
+	}{
+		{"01", "", "plain", "plain", false, false},
+		{"02", "8bit", "plain", "plain", false, false},
+		{"03", "BASE64", "SGVsbG8s\r\nIFdvcmxk", "Hello, World", true, false},
+		{"04", "base64", "SGVsbG8sIFdvcmxk\r\n", "Hello, World", true, false},
+		{"05", "base64", "SGVsbG8", "Hello", true, false},
+		{"06", "base64", "not*base64", "not*base64", false, true},
+		{"07", "quoted-printable", "St=C3=BCck =\r\nbest=C3=A4tigt", "Stück bestätigt", true, false},
+		{"08", "x-uuencode", "begin 644", "begin 644", false, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Index, func(t *testing.T) {
+			result, decoded, err := decodeTransferEncoding(test.Encoding, []byte(test.Input))
+			t.Logf(`Result: %q, decoded: %v, error: %v`, result, decoded, err)
+
+			if string(result) != test.Expected || decoded != test.Decoded || (err != nil) != test.Error {
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestUnpackTransferEncoding(t *testing.T) {
+	quietDiagnostics = true
+	defer func() { quietDiagnostics = false }()
+
+	data, err := os.ReadFile(filepath.Join("testdata", "messages", "03.attachments.testdata"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		Keep  bool
+		IsPDF bool
+		Note  string
+	}{
+		{false, true, "decoded:base64"},
+		{true, false, "encoded:base64"},
+	}
+
+	for _, test := range tests {
+		payloads := UnpackParts(RuntimeConfiguration{KeepTransferEncoding: test.Keep}, testMessageVersion(), data)
+		if len(payloads.Parts) != 3 {
+			t.Fatalf(`Expected 3 parts, got %d`, len(payloads.Parts))
+		}
+
+		invoice := payloads.Parts[1]
+		t.Logf(`Keep: %v, notes: %#v`, test.Keep, invoice.Notes)
+
+		isPDF := strings.HasPrefix(string(invoice.Contents), "%PDF-")
+		if isPDF != test.IsPDF || !slices.Equal(invoice.Notes, []string{test.Note}) {
+			t.Fail()
+		}
+	}
+}
+
+func TestUnpackerOrder(t *testing.T) {
+	quietDiagnostics = true
+	defer func() { quietDiagnostics = false }()
+
+	samples, _ := filepath.Glob(filepath.Join("testdata", "messages", "*.testdata"))
+	if len(samples) == 0 {
+		t.Fatal("no samples")
+	}
+
+	for _, workers := range []int{1, 4} {
+		t.Run(fmt.Sprint(workers), func(t *testing.T) {
+			versions := make(chan XIMessageVersion, 10)
+			payloads := make(chan XIMessagePayloads, 10)
+
+			wgUnpackers.Add(1)
+			go Unpacker(RuntimeConfiguration{UnpackThreads: workers}, versions, payloads)
+
+			go func() {
+				for i := 0; i < 50; i++ {
+					data, _ := os.ReadFile(samples[i%len(samples)])
+					entry := testMessageVersion()
+					entry.MessageVersion = fmt.Sprint(i)
+					entry.RawContents = data
+					versions <- entry
+				}
+				close(versions)
+			}()
+
+			go func() {
+				wgUnpackers.Wait()
+				close(payloads)
+			}()
+
+			i := 0
+			for p := range payloads {
+				if p.VersionID != fmt.Sprintf("LOG.%d", i) {
+					t.Errorf(`Expected version %d, got %s`, i, p.VersionID)
+				}
+				i++
+			}
+			if i != 50 {
+				t.Errorf(`Expected 50 results, got %d`, i)
+			}
+		})
+	}
+}
@@ -0,0 +1,418 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const CommandVerify string = "verify"
+
+// fileDigest is size and SHA-256 of a file found in the export
+type fileDigest struct {
+	Size   int64
+	SHA256 string
+	Error  string // file cannot be read, e.g. CRC of ZIP entry is wrong
+}
+
+// exportContents is everything verify needs to know about export: manifest and
+// digests of all files by their path relative to the export root. Files of -zip file
+// have both digest of GZIP file and its contents.
+type exportContents struct {
+	manifest []byte
+	digests  map[string][]fileDigest
+	links    map[string]string // TAR hard links to the first copy
+	key      []byte            // -encrypt key of AES-encrypted ZIP entries
+}
+
+type verifyProblem struct {
+	Path    string
+	Problem string
+}
+
+// runVerify checks exported files against checksums of manifest.csv
+func runVerify(args []string) {
+	inputs, key, err := ParseVerifyOptions(args)
+	if err != nil {
+		fmt.Printf("Error parsing command-line: %s\n", err)
+		os.Exit(1)
+	}
+
+	failed := false
+	for _, input := range inputs {
+		contents, err := readExportContents(input, key)
+		if err == nil && contents.manifest == nil {
+			err = fmt.Errorf("%s is not found", ExportManifestFilename)
+		}
+		if err != nil {
+			fmt.Printf("Cannot verify [%s]: %s\n", input, err)
+			failed = true
+			continue
+		}
+
+		checked, problems, err := verifyManifest(contents)
+		if err != nil {
+			fmt.Printf("Cannot verify [%s]: %s\n", input, err)
+			failed = true
+			continue
+		}
+
+		for _, problem := range problems {
+			fmt.Printf("[%s] %s: %s\n", input, problem.Path, problem.Problem)
+		}
+		fmt.Printf("Verified [%s]: %d files, %d OK, %d failed\n", input, checked, checked-len(problems), len(problems))
+		failed = failed || len(problems) > 0
+	}
+
+	if failed {
+		os.Exit(9)
+	}
+}
+
+// verifyManifest compares every row of the manifest with files of the export. Files of
+// the export not listed in the manifest are reported as well. Returns number of
+// checked files.
+func verifyManifest(contents exportContents) (int, []verifyProblem, error) {
+	rows, err := csv.NewReader(bytes.NewReader(contents.manifest)).ReadAll()
+	if err != nil {
+		return 0, nil, fmt.Errorf("Cannot parse %s: %s", ExportManifestFilename, err)
+	}
+	if len(rows) == 0 {
+		return 0, nil, fmt.Errorf("%s is empty", ExportManifestFilename)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range rows[0] {
+		columns[name] = i
+	}
+	for _, name := range []string{"path", "size", "sha256", "notes"} {
+		if _, ok := columns[name]; !ok {
+			return 0, nil, fmt.Errorf("%s has no [%s] column, export was created by an older version", ExportManifestFilename, name)
+		}
+	}
+
+	checked := 0
+	problems := []verifyProblem{}
+	listed := make(map[string]bool)
+	for _, row := range rows[1:] {
+		name := row[columns["path"]]
+		if name == "" {
+			// diagnostics of the message version, no file
+			continue
+		}
+		checked++
+		listed[name] = true
+
+		expected := fileDigest{SHA256: row[columns["sha256"]]}
+		expected.Size, _ = strconv.ParseInt(row[columns["size"]], 10, 64)
+
+		candidates := contents.lookup(name, row[columns["notes"]])
+		if len(candidates) == 0 {
+			problems = append(problems, verifyProblem{name, "file is missing"})
+			continue
+		}
+
+		if problem := compareDigests(expected, candidates); problem != "" {
+			problems = append(problems, verifyProblem{name, problem})
+		}
+	}
+
+	extra := []string{}
+	for name := range contents.digests {
+		if !listed[name] && !exportFiles[name] {
+			extra = append(extra, name)
+		}
+	}
+	for name := range contents.links {
+		if !listed[name] {
+			extra = append(extra, name)
+		}
+	}
+	slices.Sort(extra)
+	for _, name := range extra {
+		checked++
+		problems = append(problems, verifyProblem{name, "file is not listed in manifest"})
+	}
+
+	return checked, problems, nil
+}
+
+// exportFiles are written once per export and are not listed in the manifest
+var exportFiles = map[string]bool{
+	DynamicConfigurationFilename: true,
+	MatchesFilename:              true,
+	ArchiveIndexFilename:         true,
+	PartialMarkerName:            true,
+}
+
+// lookup returns digests of the file. Duplicates of -zip all -dedup are only in the
+// manifest, the original file is checked instead.
+func (c exportContents) lookup(name string, notes string) []fileDigest {
+	if link, ok := c.links[name]; ok {
+		name = link
+	}
+	if digests, ok := c.digests[name]; ok {
+		return digests
+	}
+
+	for _, note := range strings.Split(notes, "; ") {
+		if original, ok := strings.CutPrefix(note, "duplicate-of:"); ok {
+			return c.digests[original]
+		}
+	}
+	return nil
+}
+
+func compareDigests(expected fileDigest, candidates []fileDigest) string {
+	for _, candidate := range candidates {
+		if candidate == expected {
+			return ""
+		}
+	}
+
+	for _, candidate := range candidates {
+		if candidate.Error != "" {
+			return fmt.Sprintf("cannot be read: %s", candidate.Error)
+		}
+		if candidate.Size == expected.Size {
+			return fmt.Sprintf("checksum mismatch, expected %s, found %s", expected.SHA256, candidate.SHA256)
+		}
+	}
+	return fmt.Sprintf("size mismatch, expected %d bytes, found %d", expected.Size, candidates[len(candidates)-1].Size)
+}
+
+// SQLite database file header
+const sqliteMagic string = "SQLite format 3\x00"
+
+// readExportContents reads export folder, ZIP, TAR, TGZ archive or SQLite database
+func readExportContents(input string, key []byte) (exportContents, error) {
+	contents := exportContents{
+		digests: make(map[string][]fileDigest),
+		links:   make(map[string]string),
+		key:     key,
+	}
+
+	info, err := os.Stat(input)
+	if err != nil {
+		return contents, err
+	}
+
+	if info.IsDir() {
+		return contents, contents.readFolder(input)
+	}
+
+	file, err := os.Open(input)
+	if err != nil {
+		return contents, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	magic, _ := reader.Peek(len(sqliteMagic))
+
+	switch {
+	case bytes.HasPrefix(magic, []byte(sqliteMagic)):
+		return contents, contents.readSQLite(input)
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")):
+		return contents, contents.readZip(file, info.Size())
+	case bytes.HasPrefix(magic, []byte("\x1f\x8b")):
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return contents, err
+		}
+		return contents, contents.readTar(gzipReader)
+	default:
+		return contents, contents.readTar(reader)
+	}
+}
+
+func (c *exportContents) add(name string, data []byte) {
+	if name == ExportManifestFilename {
+		c.manifest = data
+		return
+	}
+
+	c.digests[name] = append(c.digests[name], digestOf(data))
+
+	if strings.HasSuffix(name, ".gz") {
+		// -zip file, payload is checked against decompressed contents
+		if reader, err := gzip.NewReader(bytes.NewReader(data)); err == nil {
+			if decompressed, err := io.ReadAll(reader); err == nil {
+				c.digests[name] = append(c.digests[name], digestOf(decompressed))
+			}
+		}
+	}
+}
+
+func (c *exportContents) readFolder(root string) error {
+	// archives of -split are listed in the index
+	volumes := make(map[string]bool)
+	if index, err := os.ReadFile(filepath.Join(root, ArchiveIndexFilename)); err == nil {
+		rows, _ := csv.NewReader(bytes.NewReader(index)).ReadAll()
+		for i, row := range rows {
+			if i > 0 && len(row) > 0 {
+				volumes[row[0]] = true
+			}
+		}
+	}
+
+	return filepath.WalkDir(root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+
+		relative, err := filepath.Rel(root, name)
+		if err != nil {
+			return err
+		}
+		relative = filepath.ToSlash(relative)
+
+		// volumes of interrupted export are not renamed, index lists their final names
+		if volumes[relative] || volumes[strings.TrimSuffix(relative, PartialSuffix)] {
+			file, err := os.Open(name)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+
+			info, err := file.Stat()
+			if err != nil {
+				return err
+			}
+			return c.readZip(file, info.Size())
+		}
+
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		c.add(relative, data)
+		return nil
+	})
+}
+
+func (c *exportContents) readZip(file io.ReaderAt, size int64) error {
+	reader, err := zip.NewReader(file, size)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range reader.File {
+		if entry.FileInfo().IsDir() {
+			continue
+		}
+
+		var data []byte
+		if entry.Method == zipMethodAES {
+			if c.key == nil {
+				return fmt.Errorf("Archive is encrypted, key must be specified with -encrypt")
+			}
+			data, err = decryptZipEntry(entry, c.key)
+			if err == errZipWrongPassword {
+				return fmt.Errorf("Cannot read [%s]: %s", entry.Name, err)
+			}
+		} else {
+			var rc io.ReadCloser
+			rc, err = entry.Open()
+			if err != nil {
+				return fmt.Errorf("Cannot read [%s]: %s", entry.Name, err)
+			}
+			data, err = io.ReadAll(rc)
+			rc.Close()
+		}
+		if err != nil {
+			// e.g. checksum of ZIP entry failed
+			c.digests[entry.Name] = append(c.digests[entry.Name], fileDigest{Error: err.Error()})
+			continue
+		}
+
+		c.add(entry.Name, data)
+	}
+	return nil
+}
+
+func (c *exportContents) readTar(input io.Reader) error {
+	reader := tar.NewReader(input)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		name := path.Clean(header.Name)
+		switch header.Typeflag {
+		case tar.TypeReg:
+			data, err := io.ReadAll(reader)
+			if err != nil {
+				return err
+			}
+			c.add(name, data)
+		case tar.TypeLink:
+			c.links[name] = path.Clean(header.Linkname)
+		}
+	}
+}
+
+// readSQLite builds the manifest from the payloads table of -zip sqlite and
+// recomputes checksums of contents stored in blobs
+func (c *exportContents) readSQLite(input string) error {
+	db, err := sql.Open("sqlite", "file:"+filepath.ToSlash(input)+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT p.path, p.size, p.sha256, COALESCE(p.notes, ''), b.sha256 IS NOT NULL, b.contents FROM payloads p LEFT JOIN blobs b ON b.sha256 = p.sha256 ORDER BY p.id`)
+	if err != nil {
+		return fmt.Errorf("Not an export database: %s", err)
+	}
+	defer rows.Close()
+
+	manifest := new(bytes.Buffer)
+	w := csv.NewWriter(manifest)
+	w.Write([]string{"path", "size", "sha256", "notes"})
+	for rows.Next() {
+		var name, size, checksum, notes string
+		var found bool
+		var data []byte
+		if err := rows.Scan(&name, &size, &checksum, &notes, &found, &data); err != nil {
+			return err
+		}
+		w.Write([]string{name, size, checksum, notes})
+
+		// row without blob is reported as missing file
+		if found {
+			c.digests[name] = append(c.digests[name], digestOf(data))
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	w.Flush()
+	c.manifest = manifest.Bytes()
+	return nil
+}
+
+func digestOf(data []byte) fileDigest {
+	digest := sha256.Sum256(data)
+	return fileDigest{Size: int64(len(data)), SHA256: hex.EncodeToString(digest[:])}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifyManifest(t *testing.T) {
+	payloads := XIMessagePayloads{
+		VersionID: "LOG.BI",
+		Message:   XIAdapterMessage{MessageID: "id", MessageKey: "key"},
+		// reported in manifest without path, not verified
+		Diagnostics: []string{"message headers: malformed header line"},
+		Parts: []XIPayload{
+			{Name: "MainDocument", Contents: []byte("<a/>")},
+			{Name: "Attachment", Contents: []byte("<a/>"), Notes: []string{"duplicate-of:LOG.BI/1.MainDocument"}},
+		},
+	}
+
+	manifest := newExportManifest(RuntimeConfiguration{})
+	manifest.Add(payloads, payloads.Parts[0], "LOG.BI/1.MainDocument")
+	manifest.Add(payloads, payloads.Parts[1], "LOG.BI/1.Attachment")
+
+	if !bytes.Contains(manifest.CSV(), []byte(",diagnostics,message headers: malformed header line")) {
+		t.Fatalf(`Diagnostics are missing in manifest: %s`, manifest.CSV())
+	}
+
+	tests := []struct {
+		Index    string
+		Files    map[string][]byte
+		Problems []string
+	}{
+		{"01", map[string][]byte{"LOG.BI/1.MainDocument": []byte("<a/>"), "LOG.BI/1.Attachment": []byte("<a/>")}, nil},
+		{"02", map[string][]byte{"LOG.BI/1.MainDocument": []byte("<a/>")}, nil},
+		{"03", map[string][]byte{"LOG.BI/1.MainDocument": []byte("<b/>")}, []string{"LOG.BI/1.MainDocument", "LOG.BI/1.Attachment"}},
+		{"04", map[string][]byte{"LOG.BI/1.MainDocument": []byte("<a />"), "LOG.BI/1.Attachment": []byte("<a/>")}, []string{"LOG.BI/1.MainDocument"}},
+		{"05", map[string][]byte{}, []string{"LOG.BI/1.MainDocument", "LOG.BI/1.Attachment"}},
+		{"06", map[string][]byte{"LOG.BI/1.MainDocument": []byte("<a/>"), "LOG.BI/2.Extra": []byte("<b/>"), MatchesFilename: []byte("a")}, []string{"LOG.BI/2.Extra"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Index, func(t *testing.T) {
+			contents := exportContents{manifest: manifest.CSV(), digests: make(map[string][]fileDigest)}
+			for name, data := range test.Files {
+				contents.add(name, data)
+			}
+
+			checked, problems, err := verifyManifest(contents)
+			t.Logf(`Checked: %d, problems: %v, error: %v`, checked, problems, err)
+
+			if err != nil || checked < 2 || len(problems) != len(test.Problems) {
+				t.FailNow()
+			}
+			for i, problem := range problems {
+				if problem.Path != test.Problems[i] {
+					t.Fail()
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyManifestColumns(t *testing.T) {
+	contents := exportContents{manifest: []byte("path,message_id,notes\na,b,\n")}
+
+	_, _, err := verifyManifest(contents)
+	t.Logf(`Error: %v`, err)
+
+	if err == nil {
+		t.Fail()
+	}
+}
+
+func TestVerifySQLite(t *testing.T) {
+	tests := []struct {
+		Index    string
+		Damage   string
+		Problems []string
+	}{
+		{"01", "", nil},
+		{"02", "UPDATE blobs SET contents = '<c/>' WHERE CAST(contents AS TEXT) = '<b/>'", []string{"LOG.AM/1.MainDocument"}},
+		{"03", "DELETE FROM blobs WHERE CAST(contents AS TEXT) = '<a/>'", []string{"LOG.BI/1.MainDocument", "LOG.BI/1.Attachment"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Index, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "export.db")
+			export, err := openSQLiteExport(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = export.Add(XIMessagePayloads{VersionID: "LOG.BI", Folder: "LOG.BI", Message: XIAdapterMessage{MessageID: "id", MessageKey: "key"}, Parts: []XIPayload{
+				{Filename: "1.MainDocument", Name: "MainDocument", Kind: PayloadKindPayload, Contents: []byte("<a/>")},
+				{Filename: "1.Attachment", Name: "Attachment", Kind: PayloadKindPayload, Contents: []byte("<a/>")},
+				{Filename: "1.Empty", Name: "Empty", Kind: PayloadKindPayload, Contents: []byte{}},
+			}})
+			if err == nil {
+				err = export.Add(XIMessagePayloads{VersionID: "LOG.AM", Folder: "LOG.AM", Message: XIAdapterMessage{MessageID: "id", MessageKey: "key"}, Parts: []XIPayload{
+					{Filename: "1.MainDocument", Name: "MainDocument", Kind: PayloadKindPayload, Contents: []byte("<b/>")},
+				}})
+			}
+			if err == nil && test.Damage != "" {
+				err = export.commit()
+				if err == nil {
+					_, err = export.db.Exec(test.Damage)
+				}
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := export.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			contents, err := readExportContents(filename, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checked, problems, err := verifyManifest(contents)
+			t.Logf(`Checked: %d, problems: %v, error: %v`, checked, problems, err)
+
+			if err != nil || checked != 4 || len(problems) != len(test.Problems) {
+				t.FailNow()
+			}
+			for i, problem := range problems {
+				if problem.Path != test.Problems[i] {
+					t.Fail()
+				}
+			}
+		})
+	}
+}
+
+func TestVerifySplitFolder(t *testing.T) {
+	payloads := XIMessagePayloads{VersionID: "LOG.BI", Message: XIAdapterMessage{MessageID: "id", MessageKey: "key"}}
+	manifest := newExportManifest(RuntimeConfiguration{})
+	manifest.Add(payloads, XIPayload{Name: "MainDocument", Contents: []byte("<a/>")}, "LOG.BI/1.MainDocument")
+
+	tests := []struct {
+		Index  string
+		Volume string
+	}{
+		{"01", "export.001.zip"},
+		// interrupted export
+		{"02", "export.001.zip" + PartialSuffix},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Index, func(t *testing.T) {
+			root := t.TempDir()
+
+			buffer := new(bytes.Buffer)
+			w := zip.NewWriter(buffer)
+			f, _ := w.Create("LOG.BI/1.MainDocument")
+			f.Write([]byte("<a/>"))
+			w.Close()
+
+			files := map[string][]byte{
+				test.Volume:            buffer.Bytes(),
+				ExportManifestFilename: manifest.CSV(),
+				ArchiveIndexFilename:   []byte("archive,message_id,message_key,entry,version,files\nexport.001.zip,id,key,1,LOG.BI,1\n"),
+			}
+			for name, data := range files {
+				if err := os.WriteFile(filepath.Join(root, name), data, 0666); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			contents, err := readExportContents(root, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checked, problems, err := verifyManifest(contents)
+			t.Logf(`Checked: %d, problems: %v, error: %v`, checked, problems, err)
+
+			if err != nil || checked != 1 || len(problems) != 0 {
+				t.Fail()
+			}
+		})
+	}
+}
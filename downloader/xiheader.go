@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+)
+
+const XIHeaderJSONFilename string = "header.json"
+
+// XIHeader is XI 3.0 message header (SOAP header of the first multipart part) together
+// with the manifest from SOAP body. Exported as header.json with -headerjson.
+type XIHeader struct {
+	Main                 XIHeaderMain        `xml:"http://sap.com/xi/XI/Message/30 Main" json:"main"`
+	ReliableMessaging    XIHeaderValues      `xml:"http://sap.com/xi/XI/Message/30 ReliableMessaging" json:"reliableMessaging,omitempty"`
+	DynamicConfiguration []XIHeaderRecord    `xml:"http://sap.com/xi/XI/Message/30 DynamicConfiguration>Record" json:"dynamicConfiguration,omitempty"`
+	HopList              []XIHeaderHop       `xml:"http://sap.com/xi/XI/Message/30 HopList>Hop" json:"hopList,omitempty"`
+	RunTime              XIHeaderValues      `xml:"http://sap.com/xi/XI/Message/30 RunTime" json:"runTime,omitempty"`
+	Diagnostic           XIHeaderValues      `xml:"http://sap.com/xi/XI/Message/30 Diagnostic" json:"diagnostic,omitempty"`
+	System               []XIHeaderRecord    `xml:"http://sap.com/xi/XI/Message/30 System>Record" json:"system,omitempty"`
+	Manifest             []XIManifestPayload `xml:"-" json:"manifest,omitempty"`
+}
+
+type XIHeaderMain struct {
+	VersionMajor   string            `xml:"versionMajor,attr" json:"versionMajor,omitempty"`
+	VersionMinor   string            `xml:"versionMinor,attr" json:"versionMinor,omitempty"`
+	MessageClass   string            `xml:"http://sap.com/xi/XI/Message/30 MessageClass" json:"messageClass,omitempty"`
+	ProcessingMode string            `xml:"http://sap.com/xi/XI/Message/30 ProcessingMode" json:"processingMode,omitempty"`
+	MessageID      string            `xml:"http://sap.com/xi/XI/Message/30 MessageId" json:"messageId,omitempty"`
+	RefToMessageID string            `xml:"http://sap.com/xi/XI/Message/30 RefToMessageId" json:"refToMessageId,omitempty"`
+	ConversationID string            `xml:"http://sap.com/xi/XI/Message/30 ConversationId" json:"conversationId,omitempty"`
+	TimeSent       string            `xml:"http://sap.com/xi/XI/Message/30 TimeSent" json:"timeSent,omitempty"`
+	Sender         XIHeaderParty     `xml:"http://sap.com/xi/XI/Message/30 Sender" json:"sender"`
+	Receiver       XIHeaderParty     `xml:"http://sap.com/xi/XI/Message/30 Receiver" json:"receiver"`
+	Interface      XIHeaderInterface `xml:"http://sap.com/xi/XI/Message/30 Interface" json:"interface"`
+}
+
+type XIHeaderParty struct {
+	Party struct {
+		Agency string `xml:"agency,attr" json:"agency,omitempty"`
+		Scheme string `xml:"scheme,attr" json:"scheme,omitempty"`
+		Value  string `xml:",chardata" json:"value"`
+	} `xml:"http://sap.com/xi/XI/Message/30 Party" json:"party"`
+	Service string `xml:"http://sap.com/xi/XI/Message/30 Service" json:"service"`
+}
+
+type XIHeaderInterface struct {
+	Namespace string `xml:"namespace,attr" json:"namespace"`
+	Name      string `xml:",chardata" json:"name"`
+}
+
+type XIHeaderRecord struct {
+	Namespace string `xml:"namespace,attr" json:"namespace"`
+	Name      string `xml:"name,attr" json:"name"`
+	Value     string `xml:",chardata" json:"value"`
+}
+
+type XIHeaderHop struct {
+	TimeStamp string `xml:"timeStamp,attr" json:"timeStamp,omitempty"`
+	WasRead   string `xml:"wasRead,attr" json:"wasRead,omitempty"`
+	Engine    struct {
+		Type  string `xml:"type,attr" json:"type,omitempty"`
+		Value string `xml:",chardata" json:"value"`
+	} `xml:"http://sap.com/xi/XI/Message/30 Engine" json:"engine"`
+	Adapter struct {
+		Namespace string `xml:"namespace,attr" json:"namespace,omitempty"`
+		Value     string `xml:",chardata" json:"value"`
+	} `xml:"http://sap.com/xi/XI/Message/30 Adapter" json:"adapter"`
+	MessageID string `xml:"http://sap.com/xi/XI/Message/30 MessageId" json:"messageId,omitempty"`
+	Info      string `xml:"http://sap.com/xi/XI/Message/30 Info" json:"info,omitempty"`
+}
+
+// XIHeaderValues keeps simple child elements as name-value pairs. Used for header
+// blocks with many optional fields (RunTime has 40+ of them depending on release).
+type XIHeaderValues map[string]string
+
+func (v *XIHeaderValues) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	values := XIHeaderValues{}
+
+	for {
+		token, err := d.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			var value string
+			err = d.DecodeElement(&value, &t)
+			if err != nil {
+				return err
+			}
+			if value = strings.TrimSpace(value); value != "" {
+				values[t.Name.Local] = value
+			}
+		case xml.EndElement:
+			*v = values
+			return nil
+		}
+	}
+
+	*v = values
+	return nil
+}
+
+// DynamicConfigurationValue returns value of the record by name (namespace is ignored).
+// Several values from different namespaces are joined.
+func (h *XIHeader) DynamicConfigurationValue(name string) string {
+	values := []string{}
+	for _, record := range h.DynamicConfiguration {
+		if strings.EqualFold(record.Name, name) {
+			values = append(values, record.Value)
+		}
+	}
+	return strings.Join(values, "; ")
+}
+
+func (h *XIHeader) JSON() ([]byte, error) {
+	return json.MarshalIndent(h, "", "  ")
+}
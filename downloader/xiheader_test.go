@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestXIHeader(t *testing.T) {
+	quietDiagnostics = true
+	defer func() { quietDiagnostics = false }()
+
+	data, err := os.ReadFile(filepath.Join("testdata", "messages", "01.async.xml.testdata"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payloads := UnpackParts(RuntimeConfiguration{SaveHeaderJSON: true}, testMessageVersion(), data)
+	if payloads.Header == nil {
+		t.Fatal("XI header is not parsed")
+	}
+
+	header := payloads.Header
+	tests := []struct {
+		Index    string
+		Value    string
+		Expected string
+	}{
+		{"01", header.Main.MessageClass, "ApplicationMessage"},
+		{"02", header.Main.ProcessingMode, "asynchronous"},
+		{"03", header.Main.Sender.Service, "BC_WEBSHOP"},
+		{"04", header.Main.Receiver.Service, "ERP_100"},
+		{"05", header.Main.Receiver.Party.Agency, "http://sap.com/xi/XI"},
+		{"06", header.Main.Interface.Name, "SI_Order_Out"},
+		{"07", header.Main.Interface.Namespace, "urn:example.com:orders"},
+		{"08", header.Main.TimeSent, "2023-11-21T06:05:07Z"},
+		{"09", header.ReliableMessaging["QualityOfService"], "ExactlyOnce"},
+		{"10", header.DynamicConfigurationValue("filename"), "ORDERS_20231121_0001.xml"},
+		{"11", header.DynamicConfigurationValue("Directory"), "/interfaces/in/orders"},
+		{"12", header.HopList[0].Engine.Type, "AE"},
+		{"13", header.HopList[0].Adapter.Value, "XIRA"},
+		{"14", header.Diagnostic["TraceLevel"], "Information"},
+		{"15", header.System[0].Value, "2023-11-21T06:05:07Z"},
+		{"16", header.Manifest[0].Name, "MainDocument"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Index, func(t *testing.T) {
+			if test.Value != test.Expected {
+				t.Errorf(`Expected [%s], got [%s]`, test.Expected, test.Value)
+			}
+		})
+	}
+
+	// header.json goes before payloads
+	if len(payloads.Parts) != 2 || payloads.Parts[0].Kind != PayloadKindHeaderJSON {
+		t.Fatalf(`Unexpected parts: %d`, len(payloads.Parts))
+	}
+	parsed := XIHeader{}
+	err = json.Unmarshal(payloads.Parts[0].Contents, &parsed)
+	if err != nil || parsed.Main.Sender.Service != "BC_WEBSHOP" {
+		t.Errorf(`header.json cannot be read back: %v`, err)
+	}
+
+	manifest := newExportManifest(RuntimeConfiguration{DynamicConfiguration: []string{"FileName", "SAction"}})
+	manifest.Add(payloads, payloads.Parts[0], "a")
+	manifest.Add(payloads, payloads.Parts[1], "b")
+
+	expected := "message_id,message_key,entry,version,FileName,SAction\n" +
+		"6b1c3e2e-8a11-11ee-b8d6-00000c9d89ea,6b1c3e2e-8a11-11ee-b8d6-00000c9d89ea\\OUTBOUND\\0\\EO\\0\\,6b1c3e2e-8a11-11ee-b8d6-00000c9d89ea,LOG.MS,ORDERS_20231121_0001.xml,\n"
+	if csv := string(manifest.DynamicConfigurationCSV()); csv != expected {
+		t.Errorf(`Unexpected dynamic configuration CSV: %q`, csv)
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"time"
+)
+
+// WinZip AES encryption (AE-2) of ZIP entries, supported by 7-Zip, WinZip and WinRAR.
+// See https://www.winzip.com/en/support/aes-encryption/
+const (
+	zipMethodAES        uint16 = 99
+	zipExtraAES         uint16 = 0x9901
+	zipFlagEncrypted    uint16 = 0x1
+	zipAESVersionAE2    uint16 = 2
+	zipAESStrength256   byte   = 3
+	zipAESKeyLength     int    = 32
+	zipAESSaltLength    int    = 16
+	zipAESVerifierSize  int    = 2
+	zipAESMACLength     int    = 10
+	zipAESKDFIterations int    = 1000
+)
+
+var errZipWrongPassword = errors.New("wrong encryption key")
+
+// prepareZipEntry deflates contents and encrypts them if password is set. Header is
+// ready for zip.Writer.CreateRaw.
+func prepareZipEntry(name string, contents []byte, modified time.Time, password []byte) (zipEntry, error) {
+	entry, err := compressZipEntry(name, contents, modified)
+	if err != nil || password == nil {
+		return entry, err
+	}
+	return encryptZipEntry(entry, password)
+}
+
+// writeZipEntry adds file to the archive, encrypted if password is set
+func writeZipEntry(w *zip.Writer, name string, contents []byte, modified time.Time, password []byte) error {
+	if password == nil {
+		f, err := w.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+		if err == nil {
+			_, err = f.Write(contents)
+		}
+		return err
+	}
+
+	entry, err := prepareZipEntry(name, contents, modified, password)
+	if err != nil {
+		return err
+	}
+	f, err := w.CreateRaw(entry.header)
+	if err == nil {
+		_, err = f.Write(entry.compressed)
+	}
+	return err
+}
+
+func encryptZipEntry(entry zipEntry, password []byte) (zipEntry, error) {
+	salt := make([]byte, zipAESSaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return entry, err
+	}
+	encryptionKey, authKey, verifier := zipAESKeys(password, salt, zipAESKeyLength)
+
+	data := make([]byte, 0, zipAESSaltLength+zipAESVerifierSize+len(entry.compressed)+zipAESMACLength)
+	data = append(data, salt...)
+	data = append(data, verifier...)
+
+	encrypted, err := zipAESCrypt(encryptionKey, entry.compressed)
+	if err != nil {
+		return entry, err
+	}
+	data = append(data, encrypted...)
+
+	mac := hmac.New(sha1.New, authKey)
+	mac.Write(encrypted)
+	data = append(data, mac.Sum(nil)[:zipAESMACLength]...)
+
+	extra := binary.LittleEndian.AppendUint16(nil, zipExtraAES)
+	extra = binary.LittleEndian.AppendUint16(extra, 7)
+	extra = binary.LittleEndian.AppendUint16(extra, zipAESVersionAE2)
+	extra = append(extra, 'A', 'E', zipAESStrength256)
+	extra = binary.LittleEndian.AppendUint16(extra, entry.header.Method)
+
+	header := *entry.header
+	header.Method = zipMethodAES
+	header.Flags |= zipFlagEncrypted
+	header.CRC32 = 0 // AE-2 relies on authentication code instead
+	header.Extra = append(header.Extra, extra...)
+	header.CompressedSize64 = uint64(len(data))
+
+	return zipEntry{&header, data}, nil
+}
+
+// decryptZipEntry returns contents of entry encrypted with WinZip AES
+func decryptZipEntry(file *zip.File, password []byte) ([]byte, error) {
+	method, strength, ok := zipAESExtra(file.Extra)
+	if !ok {
+		return nil, fmt.Errorf("AES extra field is missing")
+	}
+	keyLength := map[byte]int{1: 16, 2: 24, 3: 32}[strength]
+	if keyLength == 0 {
+		return nil, fmt.Errorf("AES strength [%d] is not supported", strength)
+	}
+	saltLength := keyLength / 2
+
+	raw, err := file.OpenRaw()
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(raw)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < saltLength+zipAESVerifierSize+zipAESMACLength {
+		return nil, fmt.Errorf("encrypted data is too short")
+	}
+
+	salt := data[:saltLength]
+	encrypted := data[saltLength+zipAESVerifierSize : len(data)-zipAESMACLength]
+
+	encryptionKey, authKey, verifier := zipAESKeys(password, salt, keyLength)
+	if subtle.ConstantTimeCompare(verifier, data[saltLength:saltLength+zipAESVerifierSize]) != 1 {
+		return nil, errZipWrongPassword
+	}
+
+	mac := hmac.New(sha1.New, authKey)
+	mac.Write(encrypted)
+	if !hmac.Equal(mac.Sum(nil)[:zipAESMACLength], data[len(data)-zipAESMACLength:]) {
+		return nil, fmt.Errorf("authentication code does not match, data is corrupted")
+	}
+
+	compressed, err := zipAESCrypt(encryptionKey, encrypted)
+	if err != nil {
+		return nil, err
+	}
+
+	switch method {
+	case zip.Store:
+		return compressed, nil
+	case zip.Deflate:
+		return io.ReadAll(flate.NewReader(bytes.NewReader(compressed)))
+	default:
+		return nil, fmt.Errorf("compression method [%d] is not supported", method)
+	}
+}
+
+// zipAESExtra returns actual compression method and key strength from AES extra field
+func zipAESExtra(extra []byte) (uint16, byte, bool) {
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		if len(extra) < 4+size {
+			break
+		}
+		if id == zipExtraAES && size >= 7 {
+			return binary.LittleEndian.Uint16(extra[9:]), extra[8], true
+		}
+		extra = extra[4+size:]
+	}
+	return 0, 0, false
+}
+
+// zipAESKeys derives encryption key, authentication key and password verifier
+func zipAESKeys(password []byte, salt []byte, keyLength int) ([]byte, []byte, []byte) {
+	derived := pbkdf2(sha1.New, password, salt, zipAESKDFIterations, 2*keyLength+zipAESVerifierSize)
+	return derived[:keyLength], derived[keyLength : 2*keyLength], derived[2*keyLength:]
+}
+
+// zipAESCrypt encrypts or decrypts data with AES in CTR mode. Unlike crypto/cipher CTR,
+// WinZip counter is little-endian and starts with 1.
+func zipAESCrypt(key []byte, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]byte, len(data))
+	counter := make([]byte, aes.BlockSize)
+	stream := make([]byte, aes.BlockSize)
+
+	for offset := 0; offset < len(data); offset += aes.BlockSize {
+		for i := range counter {
+			counter[i]++
+			if counter[i] != 0 {
+				break
+			}
+		}
+		block.Encrypt(stream, counter)
+
+		end := min(offset+aes.BlockSize, len(data))
+		subtle.XORBytes(result[offset:end], data[offset:end], stream)
+	}
+	return result, nil
+}
+
+// pbkdf2 implements PBKDF2 key derivation (RFC 8018)
+func pbkdf2(h func() hash.Hash, password []byte, salt []byte, iterations int, keyLength int) []byte {
+	prf := hmac.New(h, password)
+	result := make([]byte, 0, keyLength)
+	block := make([]byte, prf.Size())
+
+	for index := uint32(1); len(result) < keyLength; index++ {
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(binary.BigEndian.AppendUint32(nil, index))
+		u := prf.Sum(nil)
+		copy(block, u)
+
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			subtle.XORBytes(block, block, u)
+		}
+		result = append(result, block...)
+	}
+	return result[:keyLength]
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"testing"
+	"time"
+)
+
+func TestPBKDF2(t *testing.T) {
+	// RFC 6070
+	tests := []struct {
+		Index      string
+		Password   string
+		Salt       string
+		Iterations int
+		Length     int
+		Expected   string
+	}{
+		{"01", "password", "salt", 1, 20, "0c60c80f961f0e71f3a9b524af6012062fe037a6"},
+		{"02", "password", "salt", 2, 20, "ea6c014dc72d6f8ccd1ed92ace1d41f0d8de8957"},
+		{"03", "password", "salt", 4096, 20, "4b007901b765489abead49d926f721d065a429c1"},
+		{"04", "passwordPASSWORDpassword", "saltSALTsaltSALTsaltSALTsaltSALTsalt", 4096, 25, "3d2eec4fe41c849b80c8d83662c0e44a8b291a964cf2f07038"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Index, func(t *testing.T) {
+			result := hex.EncodeToString(pbkdf2(sha1.New, []byte(test.Password), []byte(test.Salt), test.Iterations, test.Length))
+			t.Logf(`Result: %s`, result)
+
+			if result != test.Expected {
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestZipAESRoundTrip(t *testing.T) {
+	key := []byte("secret")
+	modified := time.Date(2023, time.November, 21, 9, 5, 8, 0, time.FixedZone("", 3*60*60))
+	contents := map[string][]byte{
+		"empty.txt": {},
+		"small.xml": []byte("<a/>"),
+		"large.xml": bytes.Repeat([]byte("<Record><Field>value</Field></Record>"), 1000),
+	}
+
+	buffer := new(bytes.Buffer)
+	w := zip.NewWriter(buffer)
+	for name, data := range contents {
+		if err := writeZipEntry(w, name, data, modified, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		Index string
+		Key   string
+		Error error
+	}{
+		{"01", "secret", nil},
+		{"02", "Secret", errZipWrongPassword},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Index, func(t *testing.T) {
+			for _, file := range reader.File {
+				data, err := decryptZipEntry(file, []byte(test.Key))
+				t.Logf(`File: %s, method: %d, size: %d, error: %v`, file.Name, file.Method, len(data), err)
+
+				if file.Method != zipMethodAES || err != test.Error || !file.Modified.Equal(modified) {
+					t.Fail()
+				}
+				if err == nil && !bytes.Equal(data, contents[file.Name]) {
+					t.Fail()
+				}
+			}
+		})
+	}
+}